@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+var userAdminCommands = []string{"users", "register", "remove", "remind", "reminder", "broadcast"}
+
+// isUserAdminCommand reports whether the text is one of the admin commands to manage the users.
+// `admin register` without a mention is the registration of the admin token.
+func isUserAdminCommand(text string) bool {
+	fields := strings.Fields(text)
+	if len(fields) < 2 || fields[0] != "admin" || !containsString(userAdminCommands, fields[1]) {
+		return false
+	}
+	if fields[1] == "register" {
+		if len(fields) < 3 {
+			return false
+		}
+		_, ok := parseMention(fields[2])
+		return ok
+	}
+	return true
+}
+
+func (s *SlackListener) handleUserAdminCommand(actor, channel, text string) error {
+	fields := strings.Fields(text)
+	if fields[1] == "users" {
+		return s.listUsers(channel)
+	}
+	if fields[1] == "broadcast" {
+		message := strings.TrimSpace(strings.TrimPrefix(text, "admin broadcast"))
+		if message == "" {
+			return s.respond(channel, ":warning: Invalid parameters.")
+		}
+		return s.broadcast(actor, channel, message)
+	}
+
+	if len(fields) < 3 {
+		return s.respond(channel, ":warning: Invalid parameters.")
+	}
+	userID, ok := parseMention(fields[2])
+	if !ok {
+		return s.respond(channel, ":warning: Invalid user.")
+	}
+
+	switch fields[1] {
+	case "register":
+		if len(fields) != 4 {
+			return s.respond(channel, ":warning: Invalid parameters.")
+		}
+		user, err := UpdateUser(userID, func(user *User) error {
+			user.EmployeeID = fields[3]
+			return nil
+		})
+		if err != nil {
+			if _, findErr := FindUser(userID); findErr == nil {
+				return err
+			}
+			// The user is not registered yet.
+			_, _, imChannel, err := s.client.OpenIMChannel(userID)
+			if err != nil {
+				return fmt.Errorf("failed to open the DM channel: %s", err)
+			}
+			user = &User{
+				SlackUserID:    userID,
+				SlackChannelID: imChannel,
+				EmployeeID:     fields[3],
+				Reminder:       defaultReminder(),
+				TimeZone:       s.slackTimeZone(userID),
+			}
+			if err := user.Save(); err != nil {
+				return err
+			}
+		}
+		Audit(AuditEntry{Actor: actor, Target: userID, Action: "admin register", Source: sourceDM, Detail: fmt.Sprintf("emp_id=%s", user.EmployeeID)})
+		return s.respond(channel, fmt.Sprintf(":ok: <@%s> was registered with the employee ID %s.", userID, user.EmployeeID))
+	case "remove":
+		if len(fields) != 3 {
+			return s.respond(channel, ":warning: Invalid parameters.")
+		}
+		if err := RemoveUser(userID); err != nil {
+			return err
+		}
+		groups, err := AllGroups()
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			if !containsString(group.Members, userID) && !containsString(group.Managers, userID) {
+				continue
+			}
+			group.Members = removeStrings(group.Members, userID)
+			group.Managers = removeStrings(group.Managers, userID)
+			if err := group.Save(); err != nil {
+				return err
+			}
+		}
+		Audit(AuditEntry{Actor: actor, Target: userID, Action: "admin remove", Source: sourceDM})
+		return s.respond(channel, fmt.Sprintf(":ok: <@%s> was removed.", userID))
+	case "remind":
+		if len(fields) != 3 {
+			return s.respond(channel, ":warning: Invalid parameters.")
+		}
+		user, err := FindUser(userID)
+		if err != nil {
+			return s.respond(channel, ":warning: The user is not registered.")
+		}
+		record, err := TodayRecord(userID)
+		if err != nil {
+			sugar.Warnf("Failed to get today's record [%s]: %s", userID, err)
+			record = nil
+		}
+		if _, _, err := s.client.PostMessage(user.SlackChannelID, fmt.Sprintf(":bell: <@%s> asked me to remind you.", actor), signActions(userID, checkInOptions(user, record))); err != nil {
+			return fmt.Errorf("failed to post message: %s", err)
+		}
+		Audit(AuditEntry{Actor: actor, Target: userID, Action: "admin remind", Source: sourceDM})
+		return s.respond(channel, fmt.Sprintf(":ok: Sent a reminder to <@%s>.", userID))
+	case "reminder":
+		if len(fields) != 4 || (fields[3] != "on" && fields[3] != "off") {
+			return s.respond(channel, ":warning: Invalid parameters.")
+		}
+		if _, err := FindUser(userID); err != nil {
+			return s.respond(channel, ":warning: The user is not registered.")
+		}
+		err := updateReminder(userID, func(reminder *Reminder) { reminder.Enabled = fields[3] == "on" })
+		if err != nil {
+			return err
+		}
+		Audit(AuditEntry{Actor: actor, Target: userID, Action: "admin reminder", Source: sourceDM, Detail: fields[3]})
+		return s.respond(channel, fmt.Sprintf(":ok: Turned %s the reminder of <@%s>.", fields[3], userID))
+	}
+	return s.respond(channel, ":warning: Invalid parameters.")
+}
+
+func (s *SlackListener) listUsers(channel string) error {
+	users, err := AllUsers()
+	if err != nil {
+		return err
+	}
+
+	lines := []string{}
+	lines = append(lines, "Name                  Employee ID  Reminder  Token     Last Used         Last Error")
+	lines = append(lines, "--------------------  -----------  --------  --------  ----------------  ----------------")
+	for _, user := range users {
+		reminder := "OFF"
+		if user.Reminder.Enabled {
+			reminder = "ON"
+		}
+		lastUsed := ""
+		if !user.LastUsed.IsZero() {
+			lastUsed = user.LastUsed.In(JST()).Format("2006/01/02 15:04")
+		}
+		lastError := ""
+		if user.LastError != "" {
+			lastError = fmt.Sprintf("%s %s", user.LastErrorAt.In(JST()).Format("2006/01/02 15:04"), user.LastError)
+		}
+		lines = append(lines, fmt.Sprintf("%-20s  %-11s  %-8s  %-8s  %-16s  %s", s.displayName(user.SlackUserID), user.EmployeeID, reminder, tokenHealth(user), lastUsed, lastError))
+	}
+	return s.respond(channel, fmt.Sprintf("```\n%s\n```", strings.Join(lines, "\n")))
+}
+
+// tokenHealth is the short form of tokenStatus for the table of `admin users`.
+func tokenHealth(user *User) string {
+	switch {
+	case user.Token.AccessToken == "":
+		return "shared"
+	case user.Token.RefreshToken == "" && !user.Token.Expiry.IsZero() && user.Token.Expiry.Before(time.Now()):
+		return "expired"
+	default:
+		return "personal"
+	}
+}
+
+func (s *SlackListener) broadcast(actor, channel, message string) error {
+	users, err := AllUsers()
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, user := range users {
+		if _, _, err := s.client.PostMessage(user.SlackChannelID, message, slack.NewPostMessageParameters()); err != nil {
+			sugar.Errorf("Failed to broadcast the message [%s]: %s", user.SlackUserID, err)
+			continue
+		}
+		sent++
+	}
+	Audit(AuditEntry{Actor: actor, Action: "admin broadcast", Source: sourceDM, Detail: message})
+	return s.respond(channel, fmt.Sprintf(":ok: Sent the message to %d of %d users.", sent, len(users)))
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	auditDir = "audit"
+
+	sourceDM     = "dm"
+	sourceButton = "button"
+
+	// Only this many entries are shown by the `audit` command.
+	auditMaxEntries = 100
+)
+
+var auditMutex sync.Mutex
+
+type AuditEntry struct {
+	At     time.Time `json:"at"`
+	Actor  string    `json:"actor"`
+	Target string    `json:"target,omitempty"`
+	Action string    `json:"action"`
+	Source string    `json:"source"`
+	Detail string    `json:"detail,omitempty"`
+
+	// Date, Before and After are set for the changes of the work records.
+	Date   string                 `json:"date,omitempty"`
+	Before map[string]interface{} `json:"before,omitempty"`
+	After  map[string]interface{} `json:"after,omitempty"`
+}
+
+// auditedFields are the fields of the work record kept in the audit log.
+var auditedFields = []string{"clock_in_at", "clock_out_at", "break_records", "is_absence"}
+
+// Audit appends the entry to the journal of the month. The journals are never rewritten.
+func Audit(entry AuditEntry) {
+	if entry.At.IsZero() {
+		entry.At = time.Now()
+	}
+	if err := appendAudit(entry); err != nil {
+		sugar.Errorf("Failed to write the audit log %+v: %s", entry, err)
+	}
+}
+
+// AuditChange records a change of the work record written to freee by the user.
+// before is the record fetched before the change, parameters is the JSON sent to freee.
+func AuditChange(userID, action, source string, date time.Time, before map[string]interface{}, parameters string) {
+	var after map[string]interface{}
+	if err := json.Unmarshal([]byte(parameters), &after); err != nil {
+		sugar.Warnf("Failed to decode the parameters for the audit log: %s", err)
+	}
+	Audit(AuditEntry{
+		Actor:  userID,
+		Target: userID,
+		Action: action,
+		Source: source,
+		Date:   date.Format("2006-01-02"),
+		Before: auditedRecord(before),
+		After:  auditedRecord(after),
+	})
+}
+
+func auditedRecord(record map[string]interface{}) map[string]interface{} {
+	if record == nil {
+		return nil
+	}
+	result := map[string]interface{}{}
+	for _, field := range auditedFields {
+		if value, ok := record[field]; ok && value != nil {
+			result[field] = value
+		}
+	}
+	return result
+}
+
+// ReadAudit returns the entries recorded in [from, to) in chronological order.
+func ReadAudit(from, to time.Time) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	// The files are split by the month in JST.
+	first := from.In(JST())
+	month := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, JST())
+	for ; month.Before(to); month = month.AddDate(0, 1, 0) {
+		file, err := os.Open(fmt.Sprintf("%s/%s.jsonl", auditDir, month.Format("2006-01")))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var entry AuditEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				sugar.Warnf("Skip broken audit log entry: %s", err)
+				continue
+			}
+			if entry.At.Before(from) || !entry.At.Before(to) {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].At.Before(entries[j].At) })
+	return entries, nil
+}
+
+func appendAudit(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	if err := os.MkdirAll(auditDir, 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(fmt.Sprintf("%s/%s.jsonl", auditDir, entry.At.In(JST()).Format("2006-01")), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// handleAuditCommand shows the audit log: `audit [from] [to]` for the user's own changes,
+// and `audit @user [from] [to]` or `audit all [from] [to]` for admins.
+// The dates and the times are in the time zone of the user who runs the command.
+func (s *SlackListener) handleAuditCommand(userID, channel string, fields []string) error {
+	location := userLocation(userID)
+	target := userID
+	args := fields[1:]
+	if len(args) > 0 {
+		if mentioned, ok := parseMention(args[0]); ok {
+			target = mentioned
+			args = args[1:]
+		} else if args[0] == "all" {
+			target = ""
+			args = args[1:]
+		}
+	}
+	if len(args) > 2 {
+		return s.respond(channel, ":warning: Invalid parameters.")
+	}
+
+	to := now().In(location).AddDate(0, 0, 1)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, location)
+	from := to.AddDate(0, 0, -7)
+	if len(args) > 0 {
+		date, err := time.ParseInLocation("2006-01-02", args[0], location)
+		if err != nil {
+			return s.respond(channel, ":warning: Invalid date.")
+		}
+		from = date
+	}
+	if len(args) > 1 {
+		date, err := time.ParseInLocation("2006-01-02", args[1], location)
+		if err != nil {
+			return s.respond(channel, ":warning: Invalid date.")
+		}
+		to = date.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		return s.respond(channel, ":warning: Invalid date range.")
+	}
+
+	entries, err := ReadAudit(from, to)
+	if err != nil {
+		return err
+	}
+	lines := []string{}
+	for _, entry := range entries {
+		if target != "" && entry.Actor != target && entry.Target != target {
+			continue
+		}
+		lines = append(lines, formatAuditEntry(entry, location))
+	}
+	if len(lines) == 0 {
+		return s.respond(channel, fmt.Sprintf("No changes from %s to %s.", from.Format("2006/01/02"), to.AddDate(0, 0, -1).Format("2006/01/02")))
+	}
+	if len(lines) > auditMaxEntries {
+		lines = append([]string{fmt.Sprintf("Showing the last %d of %d changes.", auditMaxEntries, len(lines))}, lines[len(lines)-auditMaxEntries:]...)
+	}
+	return s.respond(channel, strings.Join(lines, "\n"))
+}
+
+func formatAuditEntry(entry AuditEntry, location *time.Location) string {
+	text := fmt.Sprintf("%s  <@%s>  *%s*", entry.At.In(location).Format("2006/01/02 15:04"), entry.Actor, entry.Action)
+	if entry.Target != "" && entry.Target != entry.Actor {
+		text += fmt.Sprintf(" <@%s>", entry.Target)
+	}
+	if entry.Date != "" {
+		text += fmt.Sprintf(" %s  %s → %s", strings.Replace(entry.Date, "-", "/", -1), formatAuditRecord(entry.Before, location), formatAuditRecord(entry.After, location))
+	}
+	if entry.Detail != "" {
+		text += fmt.Sprintf("  %s", entry.Detail)
+	}
+	return text + fmt.Sprintf("  (%s)", entry.Source)
+}
+
+func formatAuditRecord(record map[string]interface{}, location *time.Location) string {
+	if len(record) == 0 {
+		return "-"
+	}
+	if isAbsence, _ := record["is_absence"].(bool); isAbsence {
+		return "off"
+	}
+	clock := func(field string) string {
+		t, err := time.Parse(time.RFC3339, fmt.Sprint(record[field]))
+		if err != nil {
+			return "--:--"
+		}
+		return t.In(location).Format("15:04")
+	}
+	return fmt.Sprintf("%s-%s", clock("clock_in_at"), clock("clock_out_at"))
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Role int
+
+const (
+	RoleMember Role = iota
+	RoleManager
+	RoleAdmin
+	RoleOwner
+)
+
+var roleNames = []string{"member", "manager", "admin", "owner"}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+func ParseRole(name string) (Role, error) {
+	for i, roleName := range roleNames {
+		if strings.ToLower(name) == roleName {
+			return Role(i), nil
+		}
+	}
+	return RoleMember, fmt.Errorf("invalid role '%s'", name)
+}
+
+// configuredRoles are the owners and admins in config.toml. They can't be changed from Slack.
+var configuredRoles = map[string]Role{}
+
+func ConfigureRoles(owners, admins []string) {
+	configuredRoles = map[string]Role{}
+	for _, userID := range admins {
+		configuredRoles[userID] = RoleAdmin
+	}
+	for _, userID := range owners {
+		configuredRoles[userID] = RoleOwner
+	}
+}
+
+// commandRoles is the role required for each command. The first matching command wins,
+// and the commands not listed here are available to everyone. "@" matches a mention.
+var commandRoles = []struct {
+	command string
+	role    Role
+}{
+	{"admin register @", RoleAdmin},
+	{"admin add", RoleOwner},
+	{"admin register", RoleOwner},
+	{"admin role", RoleOwner},
+	{"admin", RoleAdmin},
+	{"report team", RoleManager},
+	{"audit @", RoleAdmin},
+	{"audit all", RoleAdmin},
+}
+
+// RoleOf returns the highest of the role in config.toml, the role granted by `admin role`
+// and the manager role derived from the groups.
+func RoleOf(userID string) Role {
+	role := RoleMember
+	if configured, ok := configuredRoles[userID]; ok {
+		role = configured
+	}
+	if role >= RoleAdmin {
+		return role
+	}
+
+	if user, err := FindUser(userID); err == nil && user.Role != "" {
+		// The owner role is granted only in config.toml.
+		if stored, err := ParseRole(user.Role); err == nil && stored > role && stored < RoleOwner {
+			role = stored
+		}
+	}
+	if role >= RoleManager {
+		return role
+	}
+
+	groups, err := AllGroups()
+	if err != nil {
+		sugar.Warnf("Failed to load groups to check the role [%s]: %s", userID, err)
+		return role
+	}
+	for _, group := range groups {
+		if group.IsManager(userID) {
+			return RoleManager
+		}
+	}
+	return role
+}
+
+// isCommand reports whether the text starts with the words of the command. "@" matches a mention.
+// The handlers of the commands in commandRoles must use it so that they match the same texts as the check.
+func isCommand(text, command string) bool {
+	fields := strings.Fields(text)
+	words := strings.Fields(command)
+	if len(fields) < len(words) {
+		return false
+	}
+	for i, word := range words {
+		if _, ok := parseMention(fields[i]); word == "@" && ok {
+			continue
+		}
+		if fields[i] != word {
+			return false
+		}
+	}
+	return true
+}
+
+// requiredRole returns the role required to run the command text and the name of the command.
+func requiredRole(text string) (Role, string) {
+	for _, entry := range commandRoles {
+		if isCommand(text, entry.command) {
+			return entry.role, entry.command
+		}
+	}
+	return RoleMember, ""
+}
+
+// authorize returns an error if the user isn't allowed to run the command text.
+func authorize(userID, text string) error {
+	required, command := requiredRole(text)
+	if required == RoleMember {
+		return nil
+	}
+	if RoleOf(userID) < required {
+		return fmt.Errorf("`%s` command requires %s privileges", command, required)
+	}
+	return nil
+}
+
+func (s *SlackListener) handleRoleCommand(actor, channel string, fields []string) error {
+	if len(fields) == 2 && fields[1] == "roles" {
+		roles := map[string]Role{}
+		for userID, role := range configuredRoles {
+			roles[userID] = role
+		}
+		users, err := AllUsers()
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if role := RoleOf(user.SlackUserID); role > RoleMember {
+				roles[user.SlackUserID] = role
+			}
+		}
+
+		userIDs := []string{}
+		for userID := range roles {
+			userIDs = append(userIDs, userID)
+		}
+		sort.Slice(userIDs, func(i, j int) bool { return roles[userIDs[i]] > roles[userIDs[j]] })
+
+		lines := []string{}
+		for _, userID := range userIDs {
+			line := fmt.Sprintf("<@%s>  %s", userID, roles[userID])
+			if _, ok := configuredRoles[userID]; ok {
+				line += " (config.toml)"
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) == 0 {
+			return s.respond(channel, "No one has a role other than member.")
+		}
+		return s.respond(channel, strings.Join(lines, "\n"))
+	}
+
+	if len(fields) != 4 {
+		return s.respond(channel, ":warning: Invalid parameters.")
+	}
+	userID, ok := parseMention(fields[2])
+	if !ok {
+		return s.respond(channel, ":warning: Invalid user.")
+	}
+	role, err := ParseRole(fields[3])
+	if err != nil || role == RoleOwner {
+		return s.respond(channel, ":warning: Invalid role. Owners can be configured only in config.toml.")
+	}
+	if _, ok := configuredRoles[userID]; ok {
+		return s.respond(channel, ":warning: The role of the user is configured in config.toml.")
+	}
+
+	if _, err := FindUser(userID); err != nil {
+		return s.respond(channel, ":warning: The user is not registered.")
+	}
+	_, err = UpdateUser(userID, func(user *User) error {
+		user.Role = role.String()
+		if role == RoleMember {
+			user.Role = ""
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	Audit(AuditEntry{Actor: actor, Target: userID, Action: "admin role", Source: sourceDM, Detail: role.String()})
+	return s.respond(channel, fmt.Sprintf(":ok: <@%s> is %s now.", userID, RoleOf(userID)))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	recordCacheDir = "records"
+
+	// Records of past days rarely change, so they are kept longer than today's record.
+	pastRecordMaxAge  = 24 * time.Hour
+	todayRecordMaxAge = 5 * time.Minute
+	recordRetention   = 62 * 24 * time.Hour
+)
+
+var recordCacheMutex sync.Mutex
+
+type RecordCache struct {
+	SlackUserID string                  `json:"slack_user_id"`
+	Records     map[string]CachedRecord `json:"records"`
+}
+
+// CachedRecord is a record fetched when the request started at FetchedAt.
+// An invalidated record has no Record, so that a fetch started before the invalidation is not cached.
+type CachedRecord struct {
+	Record    map[string]interface{} `json:"record"`
+	FetchedAt time.Time              `json:"fetched_at"`
+}
+
+func NewRecordCache(userID string) *RecordCache {
+	return &RecordCache{
+		SlackUserID: userID,
+		Records:     map[string]CachedRecord{},
+	}
+}
+
+func FindRecordCache(userID string) *RecordCache {
+	cache := RecordCache{
+		SlackUserID: userID,
+		Records:     map[string]CachedRecord{},
+	}
+
+	data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", recordCacheDir, userID))
+	if err != nil {
+		return &cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		sugar.Warnf("Discard broken record cache [%s]: %s", userID, err)
+		return NewRecordCache(userID)
+	}
+	if cache.Records == nil {
+		cache.Records = map[string]CachedRecord{}
+	}
+
+	return &cache
+}
+
+func (c *RecordCache) Get(date time.Time, maxAge time.Duration) (map[string]interface{}, bool) {
+	cached, ok := c.Records[date.Format("2006-01-02")]
+	if !ok || cached.Record == nil {
+		return nil, false
+	}
+	// A record fetched before its day ended may have changed later that day, so it is kept only as long as today's record.
+	endOfDay := time.Date(date.Year(), date.Month(), date.Day()+1, 0, 0, 0, 0, date.Location())
+	if !cached.FetchedAt.After(endOfDay) && maxAge > todayRecordMaxAge {
+		maxAge = todayRecordMaxAge
+	}
+	if time.Since(cached.FetchedAt) > maxAge {
+		return nil, false
+	}
+	return cached.Record, true
+}
+
+// Put caches the record whose request started at fetchedAt,
+// unless a newer record is already cached or the record was invalidated after the request started.
+func (c *RecordCache) Put(date time.Time, record map[string]interface{}, fetchedAt time.Time) {
+	// Error responses from the API don't have a date and must not be cached.
+	if record["date"] == nil {
+		return
+	}
+	c.put(date.Format("2006-01-02"), CachedRecord{Record: record, FetchedAt: fetchedAt})
+}
+
+// Merge puts the records of the other cache, e.g. the ones fetched while the cache was read.
+func (c *RecordCache) Merge(other *RecordCache) {
+	for day, cached := range other.Records {
+		c.put(day, cached)
+	}
+}
+
+func (c *RecordCache) put(day string, cached CachedRecord) {
+	if current, ok := c.Records[day]; ok && current.FetchedAt.After(cached.FetchedAt) {
+		return
+	}
+	c.Records[day] = cached
+}
+
+func (c *RecordCache) Save() error {
+	recordCacheMutex.Lock()
+	defer recordCacheMutex.Unlock()
+
+	for date, cached := range c.Records {
+		if time.Since(cached.FetchedAt) > recordRetention {
+			delete(c.Records, date)
+		}
+	}
+
+	text, err := json.Marshal(*c)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(recordCacheDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(fmt.Sprintf("%s/%s", recordCacheDir, c.SlackUserID), text)
+}
+
+// UpdateRecordCache re-reads the cache and saves it after the update while holding the lock,
+// so that the records put or invalidated by other requests and replicas in the meantime are not lost.
+func UpdateRecordCache(userID string, update func(cache *RecordCache)) {
+	err := withFileLock(fmt.Sprintf("%s/%s", recordCacheDir, userID), func() error {
+		cache := FindRecordCache(userID)
+		update(cache)
+		return cache.Save()
+	})
+	if err != nil {
+		sugar.Warnf("Failed to save record cache [%s]: %s", userID, err)
+	}
+}
+
+// InvalidateRecord drops the cached record after it is changed. The record is left invalidated
+// even if it is not cached, because a request which started before the change may put the old one.
+func InvalidateRecord(userID string, date time.Time) {
+	UpdateRecordCache(userID, func(cache *RecordCache) {
+		cache.Records[date.Format("2006-01-02")] = CachedRecord{FetchedAt: time.Now()}
+	})
+}
@@ -6,27 +6,68 @@ import (
 )
 
 type Config struct {
-	BotToken          string
-	VerificationToken string
-	BotID             string
-	OAuthClientID     string
-	OAuthClientSecret string
+	BotToken              string
+	VerificationToken     string
+	ButtonSecret          string
+	BotID                 string
+	OAuthClientID         string
+	OAuthClientSecret     string
+	MissedPunchDetectAt   string
+	MissedPunchFollowUpAt string
+	MonthCloseAt          string
+	MonthCloseDays        []int
+	DigestAt              string
+	UndoWindow            string
+	DayBoundary           string
+	Teams                 []Team
+	Owners                []string
+	Admins                []string
+}
+
+// Team is imported as a group on startup unless the group already exists.
+// If Members is empty, all registered users belong to the team.
+type Team struct {
+	Name     string   `toml:"name"`
+	Managers []string `toml:"managers"`
+	Members  []string `toml:"members"`
+	Channel  string   `toml:"channel"`
 }
 
 type envConfig struct {
-	BotToken          string `envconfig:"BOT_TOKEN"`
-	VerificationToken string `envconfig:"VERIFICATION_TOKEN"`
-	BotID             string `envconfig:"BOT_ID"`
-	OAuthClientID     string `envconfig:"OAUTH_CLIENT_ID"`
-	OAuthClientSecret string `envconfig:"OAUTH_CLIENT_SECRET"`
+	BotToken              string   `envconfig:"BOT_TOKEN"`
+	VerificationToken     string   `envconfig:"VERIFICATION_TOKEN"`
+	ButtonSecret          string   `envconfig:"BUTTON_SECRET"`
+	BotID                 string   `envconfig:"BOT_ID"`
+	OAuthClientID         string   `envconfig:"OAUTH_CLIENT_ID"`
+	OAuthClientSecret     string   `envconfig:"OAUTH_CLIENT_SECRET"`
+	MissedPunchDetectAt   string   `envconfig:"MISSED_PUNCH_DETECT_AT"`
+	MissedPunchFollowUpAt string   `envconfig:"MISSED_PUNCH_FOLLOW_UP_AT"`
+	MonthCloseAt          string   `envconfig:"MONTH_CLOSE_AT"`
+	MonthCloseDays        []int    `envconfig:"MONTH_CLOSE_DAYS"`
+	DigestAt              string   `envconfig:"DIGEST_AT"`
+	UndoWindow            string   `envconfig:"UNDO_WINDOW"`
+	DayBoundary           string   `envconfig:"DAY_BOUNDARY"`
+	Owners                []string `envconfig:"OWNERS"`
+	Admins                []string `envconfig:"ADMINS"`
 }
 
 type tomlConfig struct {
-	BotToken          string `toml:"bot_token"`
-	VerificationToken string `toml:"verification_token"`
-	BotID             string `toml:"bot_id"`
-	OAuthClientID     string `toml:"oauth_client_id"`
-	OAuthClientSecret string `toml:"oauth_client_secret"`
+	BotToken              string   `toml:"bot_token"`
+	VerificationToken     string   `toml:"verification_token"`
+	ButtonSecret          string   `toml:"button_secret"`
+	BotID                 string   `toml:"bot_id"`
+	OAuthClientID         string   `toml:"oauth_client_id"`
+	OAuthClientSecret     string   `toml:"oauth_client_secret"`
+	MissedPunchDetectAt   string   `toml:"missed_punch_detect_at"`
+	MissedPunchFollowUpAt string   `toml:"missed_punch_follow_up_at"`
+	MonthCloseAt          string   `toml:"month_close_at"`
+	MonthCloseDays        []int    `toml:"month_close_days"`
+	DigestAt              string   `toml:"digest_at"`
+	UndoWindow            string   `toml:"undo_window"`
+	DayBoundary           string   `toml:"day_boundary"`
+	Teams                 []Team   `toml:"teams"`
+	Owners                []string `toml:"owners"`
+	Admins                []string `toml:"admins"`
 }
 
 func LoadConfig(path, region string) (*Config, error) {
@@ -52,6 +93,13 @@ func LoadConfig(path, region string) (*Config, error) {
 	if env.VerificationToken != "" {
 		config.VerificationToken = env.VerificationToken
 	}
+	config.ButtonSecret = config.VerificationToken
+	if tc.ButtonSecret != "" {
+		config.ButtonSecret = tc.ButtonSecret
+	}
+	if env.ButtonSecret != "" {
+		config.ButtonSecret = env.ButtonSecret
+	}
 	config.BotID = tc.BotID
 	if env.BotID != "" {
 		config.BotID = env.BotID
@@ -64,6 +112,64 @@ func LoadConfig(path, region string) (*Config, error) {
 	if env.OAuthClientSecret != "" {
 		config.OAuthClientSecret = env.OAuthClientSecret
 	}
+	config.MissedPunchDetectAt = "2330"
+	if tc.MissedPunchDetectAt != "" {
+		config.MissedPunchDetectAt = tc.MissedPunchDetectAt
+	}
+	if env.MissedPunchDetectAt != "" {
+		config.MissedPunchDetectAt = env.MissedPunchDetectAt
+	}
+	config.MissedPunchFollowUpAt = "0900"
+	if tc.MissedPunchFollowUpAt != "" {
+		config.MissedPunchFollowUpAt = tc.MissedPunchFollowUpAt
+	}
+	if env.MissedPunchFollowUpAt != "" {
+		config.MissedPunchFollowUpAt = env.MissedPunchFollowUpAt
+	}
+	config.MonthCloseAt = "1000"
+	if tc.MonthCloseAt != "" {
+		config.MonthCloseAt = tc.MonthCloseAt
+	}
+	if env.MonthCloseAt != "" {
+		config.MonthCloseAt = env.MonthCloseAt
+	}
+	config.MonthCloseDays = []int{3, 0}
+	if tc.MonthCloseDays != nil {
+		config.MonthCloseDays = tc.MonthCloseDays
+	}
+	if env.MonthCloseDays != nil {
+		config.MonthCloseDays = env.MonthCloseDays
+	}
+	config.DigestAt = "0930"
+	if tc.DigestAt != "" {
+		config.DigestAt = tc.DigestAt
+	}
+	if env.DigestAt != "" {
+		config.DigestAt = env.DigestAt
+	}
+	config.UndoWindow = "30m"
+	if tc.UndoWindow != "" {
+		config.UndoWindow = tc.UndoWindow
+	}
+	if env.UndoWindow != "" {
+		config.UndoWindow = env.UndoWindow
+	}
+	config.DayBoundary = "0500"
+	if tc.DayBoundary != "" {
+		config.DayBoundary = tc.DayBoundary
+	}
+	if env.DayBoundary != "" {
+		config.DayBoundary = env.DayBoundary
+	}
+	config.Teams = tc.Teams
+	config.Owners = tc.Owners
+	if env.Owners != nil {
+		config.Owners = env.Owners
+	}
+	config.Admins = tc.Admins
+	if env.Admins != nil {
+		config.Admins = env.Admins
+	}
 
 	return &config, nil
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	dedupeDir = "dedupe"
+
+	// Slack retries a request for a few minutes at most, so the keys don't need to be kept longer.
+	dedupeTTL = 10 * time.Minute
+)
+
+// firstDelivery reports whether the key is seen for the first time in dedupeTTL.
+// The key is claimed in the shared store so that a retry handled by another replica is also detected.
+// If the store fails, the request is handled rather than dropped.
+func firstDelivery(key string) bool {
+	if err := os.MkdirAll(dedupeDir, 0755); err != nil {
+		sugar.Warnf("Failed to create dedupe store: %s", err)
+		return true
+	}
+
+	path := dedupePath(key)
+	for i := 0; i < 2; i++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			file.WriteString(key)
+			file.Close()
+			return true
+		}
+		if !os.IsExist(err) {
+			sugar.Warnf("Failed to claim dedupe key '%s': %s", key, err)
+			return true
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < dedupeTTL {
+			return false
+		}
+		os.Remove(path)
+	}
+	return false
+}
+
+// forgetDelivery releases the key so that the request can be retried, e.g. when it couldn't be accepted.
+func forgetDelivery(key string) {
+	os.Remove(dedupePath(key))
+}
+
+func dedupePath(key string) string {
+	return filepath.Join(dedupeDir, fmt.Sprintf("%x", sha1.Sum([]byte(key))))
+}
+
+// PruneDedupe removes the expired keys.
+func PruneDedupe(now time.Time) error {
+	files, err := ioutil.ReadDir(dedupeDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, file := range files {
+		if now.Sub(file.ModTime()) > dedupeTTL {
+			os.Remove(filepath.Join(dedupeDir, file.Name()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	deliveryLogDir = "deliveries"
+
+	deliverySent    = "sent"
+	deliveryLate    = "late"
+	deliverySkipped = "skipped"
+	deliveryFailed  = "failed"
+	deliveryMissed  = "missed"
+
+	deliveryRetention = 31 * 24 * time.Hour
+)
+
+var deliveryLogMutex sync.Mutex
+
+// DeliveryLog records which reminders were sent to the user.
+type DeliveryLog struct {
+	SlackUserID string     `json:"slack_user_id"`
+	Deliveries  []Delivery `json:"deliveries"`
+}
+
+type Delivery struct {
+	Kind      string    `json:"kind"`
+	FireAt    time.Time `json:"fire_at"`
+	HandledAt time.Time `json:"handled_at"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type DeliveryStore interface {
+	Delivered(entry ReminderEntry) bool
+	Record(entry ReminderEntry, status string, err error)
+}
+
+type fileDeliveryStore struct{}
+
+func FindDeliveryLog(userID string) *DeliveryLog {
+	log := DeliveryLog{
+		SlackUserID: userID,
+		Deliveries:  []Delivery{},
+	}
+
+	data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", deliveryLogDir, userID))
+	if err != nil {
+		return &log
+	}
+	if err := json.Unmarshal(data, &log); err != nil {
+		sugar.Warnf("Discard broken delivery log [%s]: %s", userID, err)
+		return &DeliveryLog{SlackUserID: userID, Deliveries: []Delivery{}}
+	}
+
+	return &log
+}
+
+func (l *DeliveryLog) Save() error {
+	deliveries := []Delivery{}
+	for _, delivery := range l.Deliveries {
+		if time.Since(delivery.FireAt) <= deliveryRetention {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	l.Deliveries = deliveries
+
+	text, err := json.Marshal(*l)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(deliveryLogDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(fmt.Sprintf("%s/%s", deliveryLogDir, l.SlackUserID), text)
+}
+
+func (fileDeliveryStore) Delivered(entry ReminderEntry) bool {
+	for _, delivery := range FindDeliveryLog(entry.UserID).Deliveries {
+		if delivery.Kind != entry.Kind || !delivery.FireAt.Equal(entry.FireAt) {
+			continue
+		}
+		if delivery.Status == deliverySent || delivery.Status == deliveryLate || delivery.Status == deliverySkipped {
+			return true
+		}
+	}
+	return false
+}
+
+func (fileDeliveryStore) Record(entry ReminderEntry, status string, err error) {
+	deliveryLogMutex.Lock()
+	defer deliveryLogMutex.Unlock()
+
+	delivery := Delivery{
+		Kind:      entry.Kind,
+		FireAt:    entry.FireAt,
+		HandledAt: time.Now(),
+		Status:    status,
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+
+	saveErr := withFileLock(fmt.Sprintf("%s/%s", deliveryLogDir, entry.UserID), func() error {
+		log := FindDeliveryLog(entry.UserID)
+		log.Deliveries = append(log.Deliveries, delivery)
+		return log.Save()
+	})
+	if saveErr != nil {
+		sugar.Errorf("Failed to save delivery log [%s]: %s", entry.UserID, saveErr)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+func (s *SlackListener) sendDigests(now time.Time) error {
+	users, err := AllUsers()
+	if err != nil {
+		return err
+	}
+	registered := map[string]*User{}
+	for _, user := range users {
+		registered[user.SlackUserID] = user
+	}
+
+	groups, err := AllGroups()
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if len(group.Managers) == 0 && group.Channel == "" {
+			continue
+		}
+		if err := s.sendDigest(group, registered, now); err != nil {
+			sugar.Errorf("Failed to send the digest of '%s': %s", group.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *SlackListener) sendDigest(team *Group, registered map[string]*User, now time.Time) error {
+	members := team.MemberIDs(registered)
+
+	noClockIn := []string{}
+	noClockOut := []string{}
+	offToday := []string{}
+	working := false
+	for _, userID := range members {
+		user, ok := registered[userID]
+		if !ok || user.DigestOptOut {
+			continue
+		}
+
+		today, err := CachedWorkRecord(userID, now, todayRecordMaxAge)
+		if err != nil {
+			sugar.Errorf("Failed to get the work record [%s]: %s", userID, err)
+			continue
+		}
+		if today["day_pattern"] == "normal_day" {
+			working = true
+			if isAbsence, _ := today["is_absence"].(bool); isAbsence {
+				offToday = append(offToday, fmt.Sprintf("<@%s>", userID))
+			}
+		}
+
+		date, record, err := previousWorkDay(userID, now)
+		if err != nil {
+			sugar.Errorf("Failed to get the work record [%s]: %s", userID, err)
+			continue
+		}
+		if record == nil {
+			continue
+		}
+		if isAbsence, _ := record["is_absence"].(bool); isAbsence {
+			continue
+		}
+		mention := fmt.Sprintf("<@%s> (%s)", userID, date.Format("01/02"))
+		if record["clock_in_at"] == nil {
+			noClockIn = append(noClockIn, mention)
+		} else if record["clock_out_at"] == nil || FindPunchLog(userID).Get(date).Unconfirmed {
+			noClockOut = append(noClockOut, mention)
+		}
+	}
+
+	// Nobody works today, e.g. a weekend or a holiday of the company.
+	if !working {
+		return nil
+	}
+
+	lines := []string{fmt.Sprintf("*Attendance digest of %s* %s", team.Name, now.Format("2006/01/02 (Mon)"))}
+	lines = append(lines, digestSection("No clock-in", noClockIn))
+	lines = append(lines, digestSection("Missing clock-out", noClockOut))
+	lines = append(lines, digestSection("Off today", offToday))
+	text := strings.Join(lines, "\n")
+
+	if team.Channel != "" {
+		_, _, err := s.client.PostMessage(team.Channel, text, slack.NewPostMessageParameters())
+		return err
+	}
+	for _, manager := range team.Managers {
+		_, _, channel, err := s.client.OpenIMChannel(manager)
+		if err != nil {
+			sugar.Errorf("Failed to open the DM with the manager [%s]: %s", manager, err)
+			continue
+		}
+		if _, _, err := s.client.PostMessage(channel, text, slack.NewPostMessageParameters()); err != nil {
+			sugar.Errorf("Failed to send the digest to the manager [%s]: %s", manager, err)
+		}
+	}
+	return nil
+}
+
+// previousWorkDay returns the latest normal day of the user's calendar within a week before now.
+func previousWorkDay(userID string, now time.Time) (time.Time, map[string]interface{}, error) {
+	for i := 1; i <= 7; i++ {
+		date := now.AddDate(0, 0, -i)
+		record, err := CachedWorkRecord(userID, date, pastRecordMaxAge)
+		if err != nil {
+			return date, nil, err
+		}
+		if record["day_pattern"] == "normal_day" {
+			return date, record, nil
+		}
+	}
+	return now, nil, nil
+}
+
+func digestSection(title string, mentions []string) string {
+	if len(mentions) == 0 {
+		return fmt.Sprintf("%s: none", title)
+	}
+	return fmt.Sprintf("%s: %s", title, strings.Join(mentions, ", "))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	fileLockRetry   = 20 * time.Millisecond
+	fileLockTimeout = 30 * time.Second
+
+	// A lock file older than this was left behind by a replica which crashed while holding it.
+	// Undo holds the lock while it restores the records one by one, so this is long enough for a month of them.
+	fileLockStale = 5 * time.Minute
+)
+
+// withFileLock serializes the read-modify-write of a file in the shared store between replicas
+// with an exclusively created lock file next to it, like the lease. It waits while another replica holds the lock.
+// The lock file is hidden so that it is not taken for a user or a log when the directory is listed.
+// The lock is not reentrant, so fn must not take the lock of the same file again.
+func withFileLock(path string, fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	dir, name := filepath.Split(path)
+	lock := filepath.Join(dir, "."+name+".lock")
+	deadline := time.Now().Add(fileLockTimeout)
+	for {
+		file, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			file.Close()
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > fileLockStale {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for the lock of '%s'", path)
+		}
+		time.Sleep(fileLockRetry)
+	}
+	defer os.Remove(lock)
+
+	return fn()
+}
+
+// writeFileAtomic replaces the file with a temporary file, so that the readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	file, err := ioutil.TempFile(dir, "."+name+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
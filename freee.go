@@ -54,42 +54,56 @@ func httpClient(user *User) (*http.Client, error) {
 	config := AuthConfig()
 	var client *http.Client
 	if user.Token.AccessToken != "" {
-		token, err := RefreshToken(config, user.Token)
+		token, err := refreshUserToken(config, user.SlackUserID)
 		if err != nil {
+			RecordError(user.SlackUserID, fmt.Errorf("failed to refresh the token: %s", err))
 			return nil, err
 		}
-		if token.AccessToken != user.Token.AccessToken {
-			user.Token = *token
-			user.Save()
-		}
+		user.Token = *token
 
 		client = config.Client(context.Background(), &user.Token)
 	} else {
-		admin, err := FindUser("admin")
+		token, err := refreshUserToken(config, "admin")
 		if err != nil {
 			return nil, err
 		}
 
-		token, err := RefreshToken(config, admin.Token)
+		client = config.Client(context.Background(), token)
+	}
+	return client, nil
+}
+
+// refreshUserToken refreshes the token of the user while holding the lock of the user,
+// because a refresh token can be used only once and another replica may be refreshing the same one.
+func refreshUserToken(config oauth2.Config, userID string) (*oauth2.Token, error) {
+	var token *oauth2.Token
+	err := withFileLock(userPath(userID), func() error {
+		user, err := FindUser(userID)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		if token.AccessToken != admin.Token.AccessToken {
-			admin.Token = *token
-			admin.Save()
+		token, err = RefreshToken(config, user.Token)
+		if err != nil {
+			return err
 		}
-
-		client = config.Client(context.Background(), &admin.Token)
+		if token.AccessToken == user.Token.AccessToken {
+			return nil
+		}
+		user.Token = *token
+		return user.write()
+	})
+	if err != nil {
+		return nil, err
 	}
-	return client, nil
+	return token, nil
 }
 
-func PunchIn(userID string) error {
+func PunchIn(userID, source string) error {
 	now := now()
-	return PunchInAt(userID, now)
+	return PunchInAt(userID, now, source)
 }
 
-func PunchInAt(userID string, inTime time.Time) error {
+func PunchInAt(userID string, inTime time.Time, source string) error {
 	user, err := FindUser(userID)
 	if err != nil {
 		return fmt.Errorf("cannot find the user '%s': %s", userID, err)
@@ -100,27 +114,96 @@ func PunchInAt(userID string, inTime time.Time) error {
 		return err
 	}
 
-	clockIn := inTime.In(JST())
+	clockIn := inTime.In(user.Location())
 	endpoint := fmt.Sprintf("%s/api/v1/employees/%s/work_records/%s", apiBase, user.EmployeeID, clockIn.Format("2006-01-02"))
 
-	parameters := `{"break_records":[],"clock_in_at":"` + clockIn.Format(time.RFC3339) + `","clock_out_at":"` + clockIn.Add(9*time.Hour).Format(time.RFC3339) + `","is_absence":false}`
+	before := previousRecord(client, endpoint)
+	parameters := `{"break_records":[],"clock_in_at":"` + freeeTime(clockIn) + `","clock_out_at":"` + freeeTime(clockIn.Add(9*time.Hour)) + `","is_absence":false}`
+	_, err = doPut(client, endpoint, parameters)
+	if err != nil {
+		return err
+	}
+	AuditChange(userID, "in", source, clockIn, before, parameters)
+	change := newChange(userID, "punch in")
+	change.add(clockIn, before)
+	change.save()
+	InvalidateRecord(userID, clockIn)
+	RecordPunch(userID, clockIn, func(punch *Punch) {
+		punch.In = clockIn
+		punch.Out = time.Time{}
+		punch.PlaceholderOut = clockIn.Add(9 * time.Hour)
+		punch.Unconfirmed = false
+	})
+
+	TouchUser(userID)
+
+	return nil
+}
+
+// CorrectInAt changes the clock-in time of the day, keeping the clock-out and the breaks already recorded.
+func CorrectInAt(userID string, inTime time.Time, source string) error {
+	user, err := FindUser(userID)
+	if err != nil {
+		return fmt.Errorf("cannot find the user '%s': %s", userID, err)
+	}
+
+	client, err := httpClient(user)
+	if err != nil {
+		return err
+	}
+
+	clockIn := inTime.In(user.Location())
+	endpoint := fmt.Sprintf("%s/api/v1/employees/%s/work_records/%s", apiBase, user.EmployeeID, clockIn.Format("2006-01-02"))
+
+	record, err := doGet(client, endpoint)
+	if err != nil {
+		return err
+	}
+	if record["clock_in_at"] == nil {
+		return PunchInAt(userID, inTime, source)
+	}
+
+	// The placeholder clock-out moves with the clock-in, while a real one is kept.
+	placeholderOut := clockIn.Add(9 * time.Hour)
+	outTime := freeeTime(placeholderOut)
+	clockOut, err := time.Parse(time.RFC3339, fmt.Sprint(record["clock_out_at"]))
+	hasClockOut := err == nil && clockOut.After(clockIn) && alreadyPunched(userID, record, false)
+	if hasClockOut {
+		outTime = freeeTime(clockOut)
+	}
+	breaks, err := json.Marshal(record["break_records"])
+	if err != nil || record["break_records"] == nil {
+		breaks = []byte("[]")
+	}
+
+	parameters := `{"break_records":` + string(breaks) + `,"clock_in_at":"` + freeeTime(clockIn) + `","clock_out_at":"` + outTime + `","is_absence":false}`
 	_, err = doPut(client, endpoint, parameters)
 	if err != nil {
 		return err
 	}
+	AuditChange(userID, "correct in", source, clockIn, record, parameters)
+	change := newChange(userID, "correction of the clock-in")
+	change.add(clockIn, record)
+	change.save()
+	InvalidateRecord(userID, clockIn)
+	RecordPunch(userID, clockIn, func(punch *Punch) {
+		punch.In = clockIn
+		if !hasClockOut {
+			punch.PlaceholderOut = placeholderOut
+		}
+	})
 
-	user.LastUsed = time.Now()
-	user.Save()
+	TouchUser(userID)
 
 	return nil
 }
 
-func PunchOut(userID string) error {
+func PunchOut(userID, source string) error {
 	now := now()
-	return PunchOutAt(userID, now)
+	return PunchOutAt(userID, now, source)
 }
 
-func PunchOutAt(userID string, outTime time.Time) error {
+func PunchOutAt(userID string, outTime time.Time, source string) error {
 	user, err := FindUser(userID)
 	if err != nil {
 		return err
@@ -131,8 +214,9 @@ func PunchOutAt(userID string, outTime time.Time) error {
 		return err
 	}
 
-	clockOut := outTime.In(JST())
-	endpoint := fmt.Sprintf("%s/api/v1/employees/%s/work_records/%s", apiBase, user.EmployeeID, clockOut.Format("2006-01-02"))
+	clockOut := outTime.In(user.Location())
+	workDate := workDateOfClockOut(client, user, clockOut)
+	endpoint := fmt.Sprintf("%s/api/v1/employees/%s/work_records/%s", apiBase, user.EmployeeID, workDate.Format("2006-01-02"))
 
 	record, err := doGet(client, endpoint)
 	if err != nil {
@@ -142,28 +226,36 @@ func PunchOutAt(userID string, outTime time.Time) error {
 	clockInAt := record["clock_in_at"]
 	var inTime string
 	if clockInAt == nil {
-		inTime = clockOut.Add(-1 * time.Minute).Format(time.RFC3339)
+		inTime = freeeTime(clockOut.Add(-1 * time.Minute))
 	} else {
 		inTime = clockInAt.(string)
 		inDate, _ := time.Parse(time.RFC3339, inTime)
 		if inDate.Unix() > clockOut.Unix() {
-			inTime = clockOut.Add(-9 * time.Hour).Format(time.RFC3339)
+			inTime = freeeTime(clockOut.Add(-9 * time.Hour))
 		}
 	}
 
-	parameters := `{"break_records":[],"clock_in_at":"` + inTime + `","clock_out_at":"` + clockOut.Format(time.RFC3339) + `","is_absence":false}`
+	parameters := `{"break_records":[],"clock_in_at":"` + inTime + `","clock_out_at":"` + freeeTime(clockOut) + `","is_absence":false}`
 	_, err = doPut(client, endpoint, parameters)
 	if err != nil {
 		return err
 	}
+	AuditChange(userID, "out", source, workDate, record, parameters)
+	change := newChange(userID, "punch out")
+	change.add(workDate, record)
+	change.save()
+	InvalidateRecord(userID, workDate)
+	RecordPunch(userID, workDate, func(punch *Punch) {
+		punch.Out = clockOut
+		punch.Unconfirmed = false
+	})
 
-	user.LastUsed = time.Now()
-	user.Save()
+	TouchUser(userID)
 
 	return nil
 }
 
-func PunchLeave(userID string) error {
+func PunchLeave(userID, source string) error {
 	user, err := FindUser(userID)
 	if err != nil {
 		return err
@@ -174,17 +266,22 @@ func PunchLeave(userID string) error {
 		return err
 	}
 
-	now := now()
+	now := user.Now()
 	endpoint := fmt.Sprintf("%s/api/v1/employees/%s/work_records/%s", apiBase, user.EmployeeID, now.Format("2006-01-02"))
 
+	before := previousRecord(client, endpoint)
 	parameters := `{"is_absence":true}`
 	_, err = doPut(client, endpoint, parameters)
 	if err != nil {
 		return err
 	}
+	AuditChange(userID, "leave", source, now, before, parameters)
+	change := newChange(userID, "leave")
+	change.add(now, before)
+	change.save()
+	InvalidateRecord(userID, now)
 
-	user.LastUsed = time.Now()
-	user.Save()
+	TouchUser(userID)
 
 	return nil
 }
@@ -200,7 +297,7 @@ func Timesheet(userID string) (map[string]interface{}, error) {
 		return nil, err
 	}
 
-	now := now()
+	now := user.Now()
 	endpoint := fmt.Sprintf("%s/api/v1/employees/%s/work_records/%s", apiBase, user.EmployeeID, now.Format("2006-1-2"))
 	record, err := doGet(client, endpoint)
 	if err != nil {
@@ -222,28 +319,96 @@ func Report(userID string) ([]map[string]interface{}, error) {
 	}
 
 	records := []map[string]interface{}{}
-	now := now()
+	fetched := NewRecordCache(userID)
+	now := user.Now()
 	start, err := time.Parse("2006-1-2", fmt.Sprintf("%d-%d-1", now.Year(), now.Month()))
 	if err != nil {
 		return nil, err
 	}
 	for d := start; d.Day() <= now.Day(); d = d.AddDate(0, 0, 1) {
 		endpoint := fmt.Sprintf("%s/api/v1/employees/%s/work_records/%s", apiBase, user.EmployeeID, d.Format("2006-01-02"))
+		fetchedAt := time.Now()
 		record, err := doGet(client, endpoint)
 		if err != nil {
 			return nil, err
 		}
+		fetched.Put(d, record, fetchedAt)
 		if record["day_pattern"] != "normal_day" {
 			continue
 		}
 
 		records = append(records, map[string]interface{}{"date": record["date"], "in": record["clock_in_at"], "out": record["clock_out_at"], "off": record["is_absence"]})
 	}
+	UpdateRecordCache(userID, func(cache *RecordCache) { cache.Merge(fetched) })
 
 	return records, nil
 }
 
-func BulkUpdate(userID string, records []map[string]interface{}) error {
+// WorkRecords returns the work records from the first day of the month to today.
+func WorkRecords(userID string) ([]map[string]interface{}, error) {
+	return MonthRecords(userID, time.Now().In(userLocation(userID)))
+}
+
+// MonthRecords returns the work records of the month up to today.
+// Records are served from the local cache when possible to save the API rate limit.
+func MonthRecords(userID string, month time.Time) ([]map[string]interface{}, error) {
+	return monthRecords(userID, month, apiLimiter)
+}
+
+// BulkMonthRecords is MonthRecords for the background jobs which fetch the records of many users.
+func BulkMonthRecords(userID string, month time.Time) ([]map[string]interface{}, error) {
+	return monthRecords(userID, month, bulkLimiter)
+}
+
+func monthRecords(userID string, month time.Time, limiter *rateLimiter) ([]map[string]interface{}, error) {
+	user, err := FindUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var client *http.Client
+	cache := FindRecordCache(userID)
+	fetched := NewRecordCache(userID)
+	records := []map[string]interface{}{}
+	now := user.Now()
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, now.Location())
+	for d := start; d.Month() == start.Month() && !d.After(now); d = d.AddDate(0, 0, 1) {
+		maxAge := pastRecordMaxAge
+		if d.Format("2006-01-02") == now.Format("2006-01-02") {
+			maxAge = todayRecordMaxAge
+		}
+		if record, ok := cache.Get(d, maxAge); ok {
+			records = append(records, record)
+			continue
+		}
+
+		if client == nil {
+			client, err = httpClient(user)
+			if err != nil {
+				return nil, err
+			}
+		}
+		endpoint := fmt.Sprintf("%s/api/v1/employees/%s/work_records/%s", apiBase, user.EmployeeID, d.Format("2006-01-02"))
+		fetchedAt := time.Now()
+		record, err := doGetWith(limiter, client, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		// An error response, e.g. for an expired token, has no date.
+		if record["date"] == nil {
+			return nil, fmt.Errorf("failed to get the record of %s: %v", d.Format("2006-01-02"), record["message"])
+		}
+		fetched.Put(d, record, fetchedAt)
+		records = append(records, record)
+	}
+	if len(fetched.Records) > 0 {
+		UpdateRecordCache(userID, func(cache *RecordCache) { cache.Merge(fetched) })
+	}
+
+	return records, nil
+}
+
+func BulkUpdate(userID string, records []map[string]interface{}, source string) error {
 	user, err := FindUser(userID)
 	if err != nil {
 		return err
@@ -254,6 +419,10 @@ func BulkUpdate(userID string, records []map[string]interface{}) error {
 		return err
 	}
 
+	// The records updated before an error can be undone too.
+	change := newChange(userID, "update")
+	defer change.save()
+
 	for i, record := range records {
 		var date string
 		if record["date"] != nil {
@@ -275,7 +444,7 @@ func BulkUpdate(userID string, records []map[string]interface{}) error {
 		}
 
 		var dateTime time.Time
-		dateTime, err = time.Parse("2006-01-02", date)
+		dateTime, err = time.ParseInLocation("2006-01-02", date, user.Location())
 		if err != nil {
 			return fmt.Errorf("an error occurred while processing the %s record", humanize.Ordinal(i+1))
 		}
@@ -283,28 +452,21 @@ func BulkUpdate(userID string, records []map[string]interface{}) error {
 		var inTime time.Time
 		var outTime time.Time
 		if !off {
-			inTime, err = time.Parse(time.RFC3339, in)
+			inTime, err = parseRecordTime(in, dateTime)
 			if err != nil {
-				inTime, err = time.Parse("15:04", in)
-				if err != nil {
-					inTime, err = time.Parse("1504", in)
-					if err != nil {
-						return fmt.Errorf("an error occurred while processing the %s record", humanize.Ordinal(i+1))
-					}
-				}
-				inTime = time.Date(dateTime.Year(), dateTime.Month(), dateTime.Day(), inTime.Hour(), inTime.Minute(), 0, 0, JST())
+				return fmt.Errorf("an error occurred while processing the %s record", humanize.Ordinal(i+1))
 			}
-
-			outTime, err = time.Parse(time.RFC3339, out)
+			outTime, err = parseRecordTime(out, dateTime)
 			if err != nil {
-				outTime, err = time.Parse("15:04", out)
-				if err != nil {
-					outTime, err = time.Parse("1504", out)
-					if err != nil {
-						return fmt.Errorf("an error occurred while processing the %s record", humanize.Ordinal(i+1))
-					}
-				}
-				outTime = time.Date(dateTime.Year(), dateTime.Month(), dateTime.Day(), outTime.Hour(), outTime.Minute(), 0, 0, JST())
+				return fmt.Errorf("an error occurred while processing the %s record", humanize.Ordinal(i+1))
+			}
+			// A clock-out past midnight is given with "out_next_day", or as a time before the clock-in.
+			// A time like "2630" is already on the next day, so "out_next_day" doesn't move it again.
+			onDate := outTime.In(dateTime.Location()).Format("2006-01-02") == date
+			if nextDay, _ := record["out_next_day"].(bool); nextDay && onDate {
+				outTime = outTime.AddDate(0, 0, 1)
+			} else if outTime.Before(inTime) && beforeDayBoundary(outTime) {
+				outTime = outTime.AddDate(0, 0, 1)
 			}
 		}
 
@@ -313,14 +475,16 @@ func BulkUpdate(userID string, records []map[string]interface{}) error {
 		if off {
 			jsonStr = `{"is_absence":true}`
 		} else {
-			jsonStr = `{"break_records":[],"clock_in_at":"` + inTime.Format(time.RFC3339) + `","clock_out_at":"` + outTime.Format(time.RFC3339) + `","is_absence":false}`
+			jsonStr = `{"break_records":[],"clock_in_at":"` + freeeTime(inTime) + `","clock_out_at":"` + freeeTime(outTime) + `","is_absence":false}`
 		}
+		before := previousRecord(client, endpoint)
 		request, err := http.NewRequest("PUT", endpoint, bytes.NewBuffer([]byte(jsonStr)))
 		if err != nil {
 			return err
 		}
 		request.Header.Set("Content-Type", "application/json")
 
+		apiLimiter.Wait()
 		response, err := client.Do(request)
 		if err != nil {
 			return err
@@ -333,37 +497,133 @@ func BulkUpdate(userID string, records []map[string]interface{}) error {
 		if response.StatusCode != http.StatusOK {
 			return fmt.Errorf("failed to request:\n\tstatus code: %d\n\tresponse: %s", response.StatusCode, string(data))
 		}
+		AuditChange(userID, "update", source, dateTime, before, jsonStr)
+		change.add(dateTime, before)
+		InvalidateRecord(userID, dateTime)
+		if !off {
+			RecordPunch(userID, dateTime, func(punch *Punch) {
+				punch.In = inTime
+				punch.Out = outTime
+				punch.PlaceholderOut = time.Time{}
+				punch.Unconfirmed = false
+			})
+		}
 	}
 
-	user.LastUsed = time.Now()
-	user.Save()
+	TouchUser(userID)
 
 	return nil
 }
 
-func IsNormalDay(userID string) bool {
+// RestoreRecord writes back a record fetched from freee before a change.
+// The record is deleted if it had no complete working hours.
+func RestoreRecord(userID string, date time.Time, record map[string]interface{}, source string) error {
 	user, err := FindUser(userID)
 	if err != nil {
-		return false
+		return err
 	}
 
 	client, err := httpClient(user)
 	if err != nil {
-		return false
+		return err
 	}
 
-	now := now()
-	endpoint := fmt.Sprintf("%s/api/v1/employees/%s/work_records/%s", apiBase, user.EmployeeID, now.Format("2006-01-02"))
+	endpoint := fmt.Sprintf("%s/api/v1/employees/%s/work_records/%s", apiBase, user.EmployeeID, date.Format("2006-01-02"))
+	before := previousRecord(client, endpoint)
 
+	parameters := "{}"
+	if isAbsence, _ := record["is_absence"].(bool); isAbsence {
+		parameters = `{"is_absence":true}`
+	} else if record["clock_in_at"] != nil && record["clock_out_at"] != nil {
+		breakRecords := record["break_records"]
+		if breakRecords == nil {
+			breakRecords = []interface{}{}
+		}
+		data, err := json.Marshal(map[string]interface{}{
+			"break_records": breakRecords,
+			"clock_in_at":   record["clock_in_at"],
+			"clock_out_at":  record["clock_out_at"],
+			"is_absence":    false,
+		})
+		if err != nil {
+			return err
+		}
+		parameters = string(data)
+	}
+
+	if parameters == "{}" {
+		err = doDelete(client, endpoint)
+	} else {
+		_, err = doPut(client, endpoint, parameters)
+	}
+	if err != nil {
+		return err
+	}
+	AuditChange(userID, "undo", source, date, before, parameters)
+	InvalidateRecord(userID, date)
+
+	TouchUser(userID)
+
+	return nil
+}
+
+func TodayRecord(userID string) (map[string]interface{}, error) {
+	return WorkRecord(userID, time.Now().In(userLocation(userID)))
+}
+
+// CachedWorkRecord returns the work record of the date from the cache if it is newer than maxAge.
+func CachedWorkRecord(userID string, date time.Time, maxAge time.Duration) (map[string]interface{}, error) {
+	if record, ok := FindRecordCache(userID).Get(date, maxAge); ok {
+		return record, nil
+	}
+	return WorkRecord(userID, date)
+}
+
+func WorkRecord(userID string, date time.Time) (map[string]interface{}, error) {
+	user, err := FindUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := httpClient(user)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v1/employees/%s/work_records/%s", apiBase, user.EmployeeID, date.Format("2006-01-02"))
+
+	fetchedAt := time.Now()
 	record, err := doGet(client, endpoint)
 	if err != nil {
-		return false
+		return nil, err
+	}
+	// An error response, e.g. for an expired token, has no date.
+	if record["date"] == nil {
+		return nil, fmt.Errorf("failed to get the record of %s: %v", date.Format("2006-01-02"), record["message"])
 	}
 
-	return record["day_pattern"] == "normal_day"
+	UpdateRecordCache(userID, func(cache *RecordCache) { cache.Put(date, record, fetchedAt) })
+
+	return record, nil
+}
+
+// previousRecord fetches the record before a change for the audit log.
+// A failure is only logged so that it doesn't prevent the change itself.
+func previousRecord(client *http.Client, endpoint string) map[string]interface{} {
+	record, err := doGet(client, endpoint)
+	if err != nil {
+		sugar.Warnf("Failed to get the record before the change [%s]: %s", endpoint, err)
+		return nil
+	}
+	return record
 }
 
 func doGet(client *http.Client, endpoint string) (map[string]interface{}, error) {
+	return doGetWith(apiLimiter, client, endpoint)
+}
+
+func doGetWith(limiter *rateLimiter, client *http.Client, endpoint string) (map[string]interface{}, error) {
+	limiter.Wait()
 	response, err := client.Get(endpoint)
 	if err != nil {
 		return nil, err
@@ -380,6 +640,23 @@ func doGet(client *http.Client, endpoint string) (map[string]interface{}, error)
 	return record, nil
 }
 
+func getJSON(client *http.Client, endpoint string, v interface{}) error {
+	apiLimiter.Wait()
+	response, err := client.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %s", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to request:\n\tstatus code: %d\n\tresponse: %s", response.StatusCode, string(data))
+	}
+
+	return json.Unmarshal(data, v)
+}
+
 func doPut(client *http.Client, endpoint string, parameters string) (*http.Response, error) {
 	request, err := http.NewRequest("PUT", endpoint, bytes.NewBuffer([]byte(parameters)))
 	if err != nil {
@@ -387,6 +664,7 @@ func doPut(client *http.Client, endpoint string, parameters string) (*http.Respo
 	}
 	request.Header.Set("Content-Type", "application/json")
 
+	apiLimiter.Wait()
 	response, err := client.Do(request)
 	if err != nil {
 		return nil, err
@@ -403,10 +681,39 @@ func doPut(client *http.Client, endpoint string, parameters string) (*http.Respo
 	return response, nil
 }
 
+func doDelete(client *http.Client, endpoint string) error {
+	request, err := http.NewRequest("DELETE", endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	apiLimiter.Wait()
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %s", err)
+	}
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to request:\n\tstatus code: %d\n\tresponse: %s", response.StatusCode, string(data))
+	}
+
+	return nil
+}
+
 func now() time.Time {
 	return time.Now().In(JST())
 }
 
+// freeeTime formats the time for freee in the time zone of the company.
+// The date of the work record is the date in the time zone of the user.
+func freeeTime(t time.Time) string {
+	return t.In(JST()).Format(time.RFC3339)
+}
+
 func JST() *time.Location {
 	return time.FixedZone("Asia/Tokyo", 9*60*60)
 }
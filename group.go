@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+const groupDir = "groups"
+
+// Group is a team or department. Groups synced from freee have the department ID,
+// and their members are replaced on every sync while the managers are kept.
+type Group struct {
+	Name         string   `json:"name"`
+	Members      []string `json:"members"`
+	Managers     []string `json:"managers"`
+	Channel      string   `json:"channel"`
+	DepartmentID int      `json:"department_id,omitempty"`
+}
+
+func FindGroup(name string) (*Group, error) {
+	if strings.Contains(name, "/") || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid group name '%s'", name)
+	}
+
+	data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", groupDir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find group [%s]: %s", name, err)
+	}
+
+	var group Group
+	if err := json.Unmarshal(data, &group); err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+// MemberIDs returns the members of the group. A group without members, e.g. a team in config.toml
+// without members, contains all registered users.
+func (g *Group) MemberIDs(registered map[string]*User) []string {
+	if len(g.Members) > 0 {
+		return g.Members
+	}
+	members := []string{}
+	for userID := range registered {
+		members = append(members, userID)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func (g *Group) Save() error {
+	text, err := json.Marshal(*g)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(groupDir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fmt.Sprintf("%s/%s", groupDir, g.Name), text, 0644)
+}
+
+func RemoveGroup(name string) error {
+	return os.Remove(fmt.Sprintf("%s/%s", groupDir, name))
+}
+
+func AllGroups() ([]*Group, error) {
+	fileInfo, err := ioutil.ReadDir(groupDir)
+	if os.IsNotExist(err) {
+		return []*Group{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []*Group{}
+	for _, file := range fileInfo {
+		if strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		group, err := FindGroup(file.Name())
+		if err != nil {
+			continue
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// ImportTeams creates a group for each team in config.toml which doesn't exist in the store yet.
+func ImportTeams(teams []Team) error {
+	for _, team := range teams {
+		if _, err := FindGroup(team.Name); err == nil {
+			continue
+		}
+		group := Group{
+			Name:     team.Name,
+			Members:  team.Members,
+			Managers: team.Managers,
+			Channel:  team.Channel,
+		}
+		if err := group.Save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendUnique(values []string, additions ...string) []string {
+	for _, addition := range additions {
+		if !containsString(values, addition) {
+			values = append(values, addition)
+		}
+	}
+	return values
+}
+
+func removeStrings(values []string, removals ...string) []string {
+	result := []string{}
+	for _, value := range values {
+		if !containsString(removals, value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncGroupsFromFreee creates or updates a group for each department of the company in freee
+// with the registered users who belong to it.
+func SyncGroupsFromFreee() (int, error) {
+	admin, err := FindUser("admin")
+	if err != nil {
+		return 0, err
+	}
+	client, err := httpClient(admin)
+	if err != nil {
+		return 0, err
+	}
+
+	companyID, err := companyID(client)
+	if err != nil {
+		return 0, err
+	}
+
+	users, err := AllUsers()
+	if err != nil {
+		return 0, err
+	}
+	slackUserIDs := map[string]string{}
+	for _, user := range users {
+		slackUserIDs[user.EmployeeID] = user.SlackUserID
+	}
+
+	type department struct {
+		name    string
+		members []string
+	}
+	departments := map[int]*department{}
+	for offset := 0; ; offset += 100 {
+		endpoint := fmt.Sprintf("%s/api/v1/employee_group_memberships?company_id=%d&base_date=%s&limit=100&offset=%d", apiBase, companyID, now().Format("2006-01-02"), offset)
+		var response struct {
+			Employees []struct {
+				ID               int `json:"id"`
+				GroupMemberships []struct {
+					GroupID   int    `json:"group_id"`
+					GroupName string `json:"group_name"`
+				} `json:"group_memberships"`
+			} `json:"employee_group_memberships"`
+			TotalCount int `json:"total_count"`
+		}
+		if err := getJSON(client, endpoint, &response); err != nil {
+			return 0, err
+		}
+
+		for _, employee := range response.Employees {
+			slackUserID, ok := slackUserIDs[fmt.Sprint(employee.ID)]
+			for _, membership := range employee.GroupMemberships {
+				d, found := departments[membership.GroupID]
+				if !found {
+					d = &department{name: membership.GroupName, members: []string{}}
+					departments[membership.GroupID] = d
+				}
+				if ok {
+					d.members = appendUnique(d.members, slackUserID)
+				}
+			}
+		}
+		if len(response.Employees) < 100 || offset+100 >= response.TotalCount {
+			break
+		}
+	}
+
+	groups, err := AllGroups()
+	if err != nil {
+		return 0, err
+	}
+	synced := map[int]*Group{}
+	for _, group := range groups {
+		if group.DepartmentID != 0 {
+			synced[group.DepartmentID] = group
+		}
+	}
+
+	for departmentID, d := range departments {
+		group, ok := synced[departmentID]
+		if !ok {
+			// A group created by hand with the same name is taken over by the department.
+			group, err = FindGroup(groupName(d.name))
+			if err != nil {
+				group = &Group{Name: groupName(d.name), Managers: []string{}}
+			}
+			group.DepartmentID = departmentID
+		}
+		sort.Strings(d.members)
+		group.Members = d.members
+		if err := group.Save(); err != nil {
+			return 0, err
+		}
+	}
+	return len(departments), nil
+}
+
+// groupName makes a department name usable as a group name in the commands and the file name.
+func groupName(name string) string {
+	return strings.Replace(strings.Join(strings.Fields(name), "-"), "/", "-", -1)
+}
+
+func companyID(client *http.Client) (int, error) {
+	var me struct {
+		Companies []struct {
+			ID int `json:"id"`
+		} `json:"companies"`
+	}
+	if err := getJSON(client, fmt.Sprintf("%s/api/v1/users/me", apiBase), &me); err != nil {
+		return 0, err
+	}
+	if len(me.Companies) == 0 {
+		return 0, fmt.Errorf("the admin doesn't belong to any company")
+	}
+	return me.Companies[0].ID, nil
+}
+
+func (s *SlackListener) handleGroupCommand(actor, channel string, fields []string) error {
+	if len(fields) == 2 && fields[1] == "groups" {
+		groups, err := AllGroups()
+		if err != nil {
+			return err
+		}
+		lines := []string{"Group             Members  Managers", "----------------  -------  --------"}
+		for _, group := range groups {
+			lines = append(lines, fmt.Sprintf("%-16s  %7d  %8d", group.Name, len(group.Members), len(group.Managers)))
+		}
+		return s.respond(channel, fmt.Sprintf("```\n%s\n```", strings.Join(lines, "\n")))
+	}
+	if len(fields) == 3 && fields[2] == "sync" {
+		s.respond(channel, ":hourglass: Syncing the groups from the departments in freee ...")
+		count, err := SyncGroupsFromFreee()
+		if err != nil {
+			return err
+		}
+		Audit(AuditEntry{Actor: actor, Action: "admin group sync", Source: sourceDM})
+		return s.respond(channel, fmt.Sprintf(":ok: Synced %d groups from freee.", count))
+	}
+	if len(fields) < 4 {
+		return s.respond(channel, ":warning: Invalid parameters.")
+	}
+
+	subcommand := fields[2]
+	name := fields[3]
+	if strings.ContainsAny(name, "/.") {
+		return s.respond(channel, ":warning: Invalid group name.")
+	}
+
+	if subcommand == "create" {
+		if _, err := FindGroup(name); err == nil {
+			return s.respond(channel, fmt.Sprintf(":warning: Group '%s' already exists.", name))
+		}
+		group := Group{Name: name, Members: []string{}, Managers: []string{}}
+		if err := group.Save(); err != nil {
+			return err
+		}
+		Audit(AuditEntry{Actor: actor, Action: "admin group create", Source: sourceDM, Detail: name})
+		return s.respond(channel, fmt.Sprintf(":ok: Group '%s' was created.", name))
+	}
+	if subcommand == "delete" {
+		if err := RemoveGroup(name); err != nil {
+			return err
+		}
+		Audit(AuditEntry{Actor: actor, Action: "admin group delete", Source: sourceDM, Detail: name})
+		return s.respond(channel, fmt.Sprintf(":ok: Group '%s' was deleted.", name))
+	}
+
+	group, err := FindGroup(name)
+	if err != nil {
+		if subcommand != "add" {
+			return err
+		}
+		group = &Group{Name: name, Members: []string{}, Managers: []string{}}
+	}
+
+	userIDs := []string{}
+	for _, field := range fields[4:] {
+		userID, ok := parseMention(field)
+		if !ok {
+			continue
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	switch subcommand {
+	case "show":
+		lines := []string{fmt.Sprintf("*%s*", group.Name)}
+		lines = append(lines, fmt.Sprintf("Members: %s", mentions(group.Members)))
+		lines = append(lines, fmt.Sprintf("Managers: %s", mentions(group.Managers)))
+		if group.Channel != "" {
+			lines = append(lines, fmt.Sprintf("Channel: <#%s>", group.Channel))
+		}
+		return s.respond(channel, strings.Join(lines, "\n"))
+	case "add":
+		group.Members = appendUnique(group.Members, userIDs...)
+	case "remove":
+		group.Members = removeStrings(group.Members, userIDs...)
+		group.Managers = removeStrings(group.Managers, userIDs...)
+	case "manager":
+		group.Managers = appendUnique(group.Managers, userIDs...)
+	case "channel":
+		if len(fields) != 5 || !strings.HasPrefix(fields[4], "<#") || !strings.HasSuffix(fields[4], ">") {
+			return s.respond(channel, ":warning: Invalid channel.")
+		}
+		group.Channel = strings.SplitN(fields[4][2:len(fields[4])-1], "|", 2)[0]
+	default:
+		return s.respond(channel, ":warning: Invalid parameters.")
+	}
+
+	if err := group.Save(); err != nil {
+		return err
+	}
+	Audit(AuditEntry{Actor: actor, Action: "admin group " + subcommand, Source: sourceDM, Detail: strings.Join(fields[3:], " ")})
+	return s.respond(channel, fmt.Sprintf(":ok: Group '%s' was updated.", name))
+}
+
+func mentions(userIDs []string) string {
+	if len(userIDs) == 0 {
+		return "none"
+	}
+	results := []string{}
+	for _, userID := range userIDs {
+		results = append(results, fmt.Sprintf("<@%s>", userID))
+	}
+	return strings.Join(results, ", ")
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	slackAPIBase = "https://slack.com/api"
+
+	homeActionReminderOn   = "home_reminder_on"
+	homeActionReminderOff  = "home_reminder_off"
+	homeActionReminderEdit = "home_reminder_edit"
+
+	reminderEditCallbackID = "reminder_edit"
+)
+
+type eventHandler struct {
+	botToken          string
+	verificationToken string
+}
+
+type eventCallback struct {
+	Token     string `json:"token"`
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	EventID   string `json:"event_id"`
+	Event     struct {
+		Type string `json:"type"`
+		User string `json:"user"`
+		Tab  string `json:"tab"`
+	} `json:"event"`
+}
+
+type blockActionCallback struct {
+	Type      string `json:"type"`
+	Token     string `json:"token"`
+	TriggerID string `json:"trigger_id"`
+	User      struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	View struct {
+		CallbackID string `json:"callback_id"`
+		State      struct {
+			Values map[string]map[string]struct {
+				Value string `json:"value"`
+			} `json:"values"`
+		} `json:"state"`
+	} `json:"view"`
+}
+
+func (h eventHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sugar.Errorf("Invalid method: %s", r.Method)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sugar.Errorf("Failed to read request body: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var event eventCallback
+	if err := json.Unmarshal(buf, &event); err != nil {
+		sugar.Errorf("Failed to decode json event from slack: %s", string(buf))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if event.Token != h.verificationToken {
+		sugar.Errorf("Invalid token: %s", event.Token)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch event.Type {
+	case "url_verification":
+		w.Header().Add("Content-type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(event.Challenge))
+	case "event_callback":
+		w.WriteHeader(http.StatusOK)
+		if event.EventID != "" && !firstDelivery("event:"+event.EventID) {
+			sugar.Infof("Ignored a retried event: %s", event.EventID)
+			return
+		}
+		if event.Event.Type == "app_home_opened" && event.Event.Tab == "home" {
+			go func() {
+				if err := publishHome(h.botToken, event.Event.User); err != nil {
+					sugar.Errorf("Failed to publish home [%s]: %s", event.Event.User, err)
+				}
+			}()
+		}
+	default:
+		sugar.Errorf("Invalid event type: %s", event.Type)
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (h interactionHandler) serveBlockAction(w http.ResponseWriter, jsonStr string) {
+	var callback blockActionCallback
+	if err := json.Unmarshal([]byte(jsonStr), &callback); err != nil {
+		sugar.Errorf("Failed to decode json message from slack: %s", jsonStr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if callback.Token != h.verificationToken {
+		sugar.Errorf("Invalid token: %s", callback.Token)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// A retry by Slack has the same trigger ID.
+	if callback.TriggerID != "" && !firstDelivery("trigger:"+callback.TriggerID) {
+		sugar.Infof("Ignored a retried %s [%s]", callback.Type, callback.User.ID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	userID := callback.User.ID
+	if callback.Type == "view_submission" {
+		if callback.View.CallbackID != reminderEditCallbackID {
+			sugar.Errorf("Invalid view was submitted: %s", callback.View.CallbackID)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		values := callback.View.State.Values
+		am, amErr := time.Parse("1504", values["am"]["am"].Value)
+		pm, pmErr := time.Parse("1504", values["pm"]["pm"].Value)
+		if amErr != nil || pmErr != nil {
+			errors := map[string]string{}
+			if amErr != nil {
+				errors["am"] = "Enter the time as HHMM, e.g. 0900."
+			}
+			if pmErr != nil {
+				errors["pm"] = "Enter the time as HHMM, e.g. 1700."
+			}
+			w.Header().Add("Content-type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]interface{}{"response_action": "errors", "errors": errors})
+			return
+		}
+
+		err := updateReminder(userID, func(reminder *Reminder) {
+			reminder.Enabled = true
+			reminder.AM = am
+			reminder.PM = pm
+		})
+		if err != nil {
+			sugar.Errorf("Failed to update reminder [%s]: %s", userID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		go h.republishHome(userID)
+		return
+	}
+
+	if len(callback.Actions) == 0 {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	switch callback.Actions[0].ActionID {
+	case homeActionReminderOn, homeActionReminderOff:
+		enabled := callback.Actions[0].ActionID == homeActionReminderOn
+		if err := updateReminder(userID, func(reminder *Reminder) { reminder.Enabled = enabled }); err != nil {
+			sugar.Errorf("Failed to update reminder [%s]: %s", userID, err)
+			return
+		}
+		go h.republishHome(userID)
+	case homeActionReminderEdit:
+		user, err := FindUser(userID)
+		if err != nil {
+			sugar.Errorf("Failed to find user [%s]: %s", userID, err)
+			return
+		}
+		go func() {
+			parameters := map[string]interface{}{
+				"trigger_id": callback.TriggerID,
+				"view":       reminderEditView(user.Reminder),
+			}
+			if err := callSlackAPI(h.botToken, "views.open", parameters); err != nil {
+				sugar.Errorf("Failed to open reminder editor [%s]: %s", userID, err)
+			}
+		}()
+	default:
+		sugar.Errorf("Invalid block action was submitted: %s", callback.Actions[0].ActionID)
+	}
+}
+
+func (h interactionHandler) republishHome(userID string) {
+	if err := publishHome(h.botToken, userID); err != nil {
+		sugar.Errorf("Failed to publish home [%s]: %s", userID, err)
+	}
+}
+
+func updateReminder(userID string, update func(reminder *Reminder)) error {
+	_, err := UpdateUser(userID, func(user *User) error {
+		update(&user.Reminder)
+		return nil
+	})
+	return err
+}
+
+func publishHome(botToken, userID string) error {
+	parameters := map[string]interface{}{
+		"user_id": userID,
+		"view": map[string]interface{}{
+			"type":   "home",
+			"blocks": homeBlocks(userID),
+		},
+	}
+	return callSlackAPI(botToken, "views.publish", parameters)
+}
+
+func homeBlocks(userID string) []interface{} {
+	user, err := FindUser(userID)
+	if err != nil {
+		return []interface{}{
+			sectionBlock("*You are not registered yet.*\nSend `add [emp_id]` to me in a direct message to start recording your attendance."),
+		}
+	}
+
+	blocks := []interface{}{}
+	now := user.Now()
+	location := user.Location()
+	records, err := WorkRecords(userID)
+	if err != nil {
+		blocks = append(blocks, sectionBlock(fmt.Sprintf(":warning: Failed to load your work records: %s", err)))
+	} else {
+		var today map[string]interface{}
+		incompleteDays := []string{}
+		var total time.Duration
+		for _, record := range records {
+			day, ok := record["date"].(string)
+			if !ok {
+				continue
+			}
+			date, _ := time.Parse("2006-01-02", day)
+			if date.Day() == now.Day() {
+				today = record
+			} else if isIncompleteRecord(record) {
+				incompleteDays = append(incompleteDays, date.Format("01/02 (Mon)"))
+			}
+			total += workDuration(record)
+		}
+
+		blocks = append(blocks, sectionBlock(fmt.Sprintf("*Today* %s\n%s", now.Format("2006/01/02 (Mon)"), todaySummary(today, location))))
+		blocks = append(blocks, dividerBlock())
+
+		incomplete := "None :tada:"
+		if len(incompleteDays) > 0 {
+			incomplete = strings.Join(incompleteDays, ", ")
+		}
+		blocks = append(blocks, sectionBlock(fmt.Sprintf("*This month* %s\nTotal hours: *%s*\nIncomplete days: %s", now.Format("2006/01"), formatDuration(total), incomplete)))
+	}
+	blocks = append(blocks, dividerBlock())
+
+	reminder := user.Reminder
+	var reminderText string
+	var toggle interface{}
+	if reminder.Enabled {
+		reminderText = fmt.Sprintf("*Reminder* ON\n```\n%s\n```", strings.Join(reminderSchedule(reminder), "\n"))
+		toggle = buttonElement("Turn off", homeActionReminderOff, "danger")
+	} else {
+		reminderText = "*Reminder* OFF"
+		toggle = buttonElement("Turn on", homeActionReminderOn, "primary")
+	}
+	blocks = append(blocks, sectionBlock(reminderText))
+	blocks = append(blocks, map[string]interface{}{
+		"type":     "actions",
+		"elements": []interface{}{buttonElement("Edit", homeActionReminderEdit, ""), toggle},
+	})
+	blocks = append(blocks, dividerBlock())
+
+	blocks = append(blocks, sectionBlock(fmt.Sprintf("*Registration*\nEmployee ID: %s\nAccess token: %s", user.EmployeeID, tokenStatus(user))))
+
+	return blocks
+}
+
+func todaySummary(record map[string]interface{}, location *time.Location) string {
+	if record == nil {
+		return "No record yet."
+	}
+	// An error response from the API has no date.
+	if record["date"] == nil {
+		return ":warning: Failed to get the record."
+	}
+	if record["day_pattern"] != "normal_day" {
+		return "Holiday"
+	}
+	if isAbsence, _ := record["is_absence"].(bool); isAbsence {
+		return "Off"
+	}
+
+	breaks := []string{}
+	if breakRecords, ok := record["break_records"].([]interface{}); ok {
+		for _, breakRecord := range breakRecords {
+			b, ok := breakRecord.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			breaks = append(breaks, fmt.Sprintf("%s-%s", formatClock(b["clock_in_at"], location), formatClock(b["clock_out_at"], location)))
+		}
+	}
+	breakText := "none"
+	if len(breaks) > 0 {
+		breakText = strings.Join(breaks, ", ")
+	}
+
+	return fmt.Sprintf("In: *%s*  Out: *%s*  Break: %s", formatClock(record["clock_in_at"], location), formatClock(record["clock_out_at"], location), breakText)
+}
+
+func tokenStatus(user *User) string {
+	if user.Token.AccessToken == "" {
+		if _, err := FindUser("admin"); err != nil {
+			return ":warning: Not authorized. Send `auth` to me to get an authorization code."
+		}
+		return "Using the shared admin token"
+	}
+	if user.Token.RefreshToken == "" && !user.Token.Expiry.IsZero() && user.Token.Expiry.Before(time.Now()) {
+		return ":warning: Expired. Send `auth` to me to authorize again."
+	}
+	return "Personal token"
+}
+
+func isIncompleteRecord(record map[string]interface{}) bool {
+	if record["day_pattern"] != "normal_day" {
+		return false
+	}
+	if isAbsence, _ := record["is_absence"].(bool); isAbsence {
+		return false
+	}
+	return record["clock_in_at"] == nil || record["clock_out_at"] == nil
+}
+
+func workDuration(record map[string]interface{}) time.Duration {
+	in, inErr := time.Parse(time.RFC3339, fmt.Sprint(record["clock_in_at"]))
+	out, outErr := time.Parse(time.RFC3339, fmt.Sprint(record["clock_out_at"]))
+	if inErr != nil || outErr != nil || out.Before(in) {
+		return 0
+	}
+
+	duration := out.Sub(in)
+	if breakRecords, ok := record["break_records"].([]interface{}); ok {
+		for _, breakRecord := range breakRecords {
+			b, ok := breakRecord.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			breakIn, inErr := time.Parse(time.RFC3339, fmt.Sprint(b["clock_in_at"]))
+			breakOut, outErr := time.Parse(time.RFC3339, fmt.Sprint(b["clock_out_at"]))
+			if inErr == nil && outErr == nil && breakOut.After(breakIn) {
+				duration -= breakOut.Sub(breakIn)
+			}
+		}
+	}
+	return duration
+}
+
+func formatClock(value interface{}, location *time.Location) string {
+	if value == nil {
+		return "--:--"
+	}
+	clock, err := time.Parse(time.RFC3339, fmt.Sprint(value))
+	if err != nil {
+		return "--:--"
+	}
+	return clock.In(location).Format("15:04")
+}
+
+func formatDuration(duration time.Duration) string {
+	minutes := int(duration.Minutes())
+	return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+}
+
+func reminderEditView(reminder Reminder) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "modal",
+		"callback_id": reminderEditCallbackID,
+		"title":       plainText("Reminder"),
+		"submit":      plainText("Save"),
+		"close":       plainText("Cancel"),
+		"blocks": []interface{}{
+			timeInputBlock("am", "Morning (HHMM)", reminder.AM.Format("1504")),
+			timeInputBlock("pm", "Evening (HHMM)", reminder.PM.Format("1504")),
+		},
+	}
+}
+
+func sectionBlock(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "section",
+		"text": map[string]interface{}{"type": "mrkdwn", "text": text},
+	}
+}
+
+func dividerBlock() map[string]interface{} {
+	return map[string]interface{}{"type": "divider"}
+}
+
+func buttonElement(text, actionID, style string) map[string]interface{} {
+	button := map[string]interface{}{
+		"type":      "button",
+		"text":      plainText(text),
+		"action_id": actionID,
+	}
+	if style != "" {
+		button["style"] = style
+	}
+	return button
+}
+
+func timeInputBlock(id, label, initial string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "input",
+		"block_id": id,
+		"label":    plainText(label),
+		"element": map[string]interface{}{
+			"type":          "plain_text_input",
+			"action_id":     id,
+			"initial_value": initial,
+			"max_length":    4,
+		},
+	}
+}
+
+func plainText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "plain_text", "text": text}
+}
+
+func callSlackAPI(botToken, method string, parameters interface{}) error {
+	body, err := json.Marshal(parameters)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", fmt.Sprintf("%s/%s", slackAPIBase, method), bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json; charset=utf-8")
+	request.Header.Set("Authorization", "Bearer "+botToken)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %s", err)
+	}
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("failed to call %s: %s", method, result.Error)
+	}
+
+	return nil
+}
@@ -1,17 +1,43 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/nlopes/slack"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync"
 	"time"
 )
 
+const (
+	actionWorkers    = 4
+	actionQueueSize  = 100
+	progressInterval = 3 * time.Second
+
+	// Slack accepts 5 requests to a response_url. The progress leaves one of them for the result.
+	maxProgressReports = 3
+
+	processingTitle = ":hourglass_flowing_sand: Processing..."
+)
+
+var (
+	actionQueue = make(chan slack.AttachmentActionCallback, actionQueueSize)
+
+	// slowActions write to freee, which may take longer than Slack waits for the response.
+	slowActions = []string{actionIn, actionOut, actionCorrectIn, actionLeave, actionUndo, actionMissedOut, actionFillUsual, actionMarkOff}
+
+	// attachmentActions replace only the attachment which they were taken on.
+	attachmentActions = []string{actionMissedConfirm, actionMissedOut, actionFillUsual, actionMarkOff}
+)
+
 type interactionHandler struct {
 	slackClient       *slack.Client
+	botToken          string
 	verificationToken string
 }
 
@@ -36,6 +62,14 @@ func (h interactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var payload struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &payload); err == nil && (payload.Type == "block_actions" || payload.Type == "view_submission") {
+		h.serveBlockAction(w, jsonStr)
+		return
+	}
+
 	var message slack.AttachmentActionCallback
 	if err := json.Unmarshal([]byte(jsonStr), &message); err != nil {
 		sugar.Errorf("Failed to decode json message from slack: %s", jsonStr)
@@ -49,45 +83,297 @@ func (h interactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	owner, ok := verifyOwner(&message)
+	if !ok {
+		sugar.Warnf("Invalid signature of the action '%s' [%s]", message.Actions[0].Name, message.User.ID)
+		writeEphemeral(w, ":warning: Sorry, these buttons can't be used. Send `in` or `out` to me to punch.")
+		return
+	}
+	if owner != message.User.ID && (owner != "" || !ownDirectMessage(message)) {
+		sugar.Warnf("Rejected the action '%s' on the message of <%s> [%s]", message.Actions[0].Name, owner, message.User.ID)
+		text := "Sorry, these buttons are not for you."
+		if owner != "" {
+			text = fmt.Sprintf("Sorry, these buttons are for <@%s> only.", owner)
+		}
+		writeEphemeral(w, text+" Send `in` or `out` to me to punch for yourself.")
+		return
+	}
+
+	key := actionKey(message)
+	if !firstDelivery(key) {
+		sugar.Infof("Ignored a duplicate action '%s' [%s]", message.Actions[0].Name, message.User.ID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if !containsString(slowActions, message.Actions[0].Name) {
+		reply, err := actionReply(message, nil)
+		if err != nil {
+			// Slack retries the failed request, which must not be ignored as a duplicate.
+			forgetDelivery(key)
+			sugar.Errorf("Failed to handle the action [%s]: %s", message.User.ID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeMessage(w, reply)
+		return
+	}
+
+	// Slack shows an error unless the action is acknowledged within 3 seconds, so the message shows
+	// that the action is being processed and the workers replace it through response_url when the work is done.
+	select {
+	case actionQueue <- message:
+		writeMessage(w, progressMessage(message, processingTitle))
+	default:
+		forgetDelivery(key)
+		sugar.Warnf("Action queue is full. Rejected '%s' [%s]", message.Actions[0].Name, message.User.ID)
+		writeEphemeral(w, ":warning: I'm busy right now. Please try again in a moment.")
+	}
+}
+
+// RunActionWorkers processes the queued actions until ctx is canceled.
+func RunActionWorkers(ctx context.Context, workers int) error {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case message := <-actionQueue:
+					processAction(message)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func processAction(message slack.AttachmentActionCallback) {
+	// The workers are not covered by the recovery of net/http or the supervisor.
+	defer func() {
+		if r := recover(); r != nil {
+			sugar.Errorf("Panic while handling the action '%s' [%s]: %v", message.Actions[0].Name, message.User.ID, r)
+			reply := slack.Message{}
+			reply.Text = fmt.Sprintf(":warning: Error occurred: %v", r)
+			if err := respondURL(message.ResponseURL, reply); err != nil {
+				sugar.Errorf("Failed to respond to the action [%s]: %s", message.User.ID, err)
+			}
+		}
+	}()
+
+	var lastProgress time.Time
+	reports := 0
+	progress := func(title string) {
+		// response_url accepts only a few requests, so the progress is reported sparingly.
+		if reports >= maxProgressReports || time.Since(lastProgress) < progressInterval {
+			return
+		}
+		reports++
+		lastProgress = time.Now()
+		if err := respondURL(message.ResponseURL, progressMessage(message, title)); err != nil {
+			sugar.Warnf("Failed to report the progress [%s]: %s", message.User.ID, err)
+		}
+	}
+
+	reply, err := actionReply(message, progress)
+	if err != nil {
+		sugar.Errorf("Failed to handle the action [%s]: %s", message.User.ID, err)
+		reply = progressMessage(message, fmt.Sprintf(":warning: Error occurred: %s", err))
+	}
+	if err := respondURL(message.ResponseURL, reply); err != nil {
+		sugar.Errorf("Failed to respond to the action [%s]: %s", message.User.ID, err)
+	}
+}
+
+// progressMessage shows the state of the action in place of the buttons which were clicked.
+func progressMessage(message slack.AttachmentActionCallback, title string) slack.Message {
+	if containsString(attachmentActions, message.Actions[0].Name) {
+		return responseAttachment(message.OriginalMessage, message.AttachmentID, title)
+	}
+	return responseMessage(message.OriginalMessage, title, "", "")
+}
+
+// actionKey identifies the click on a button. A retry by Slack and a second click on the same button have the same key.
+// The buttons are removed from the message once the action is done, so a button is clicked only once.
+func actionKey(message slack.AttachmentActionCallback) string {
+	ts := message.MessageTs
+	if ts == "" {
+		ts = message.ActionTs
+	}
+	return fmt.Sprintf("action:%s:%s:%s:%s:%s", message.User.ID, message.Channel.ID, ts, message.AttachmentID, message.Actions[0].Name)
+}
+
+// actionReply does the action and returns the message to replace the original one.
+// progress reports the state of a long action. It is nil for the actions which are not slowActions.
+func actionReply(message slack.AttachmentActionCallback, progress func(title string)) (slack.Message, error) {
 	action := message.Actions[0]
 	switch action.Name {
 	case actionIn:
-		title := fmt.Sprintf(":ok: You have punched in at *%s*.", time.Now().Format("2006/01/02 15:04"))
-		err := PunchIn(message.User.ID)
+		clock, err := actionTime(action.Value, message.ActionTs)
+		if err != nil {
+			return slack.Message{}, fmt.Errorf("invalid time: %s", action.Value)
+		}
+		title := fmt.Sprintf(":ok: You have punched in at *%s*.", clock.In(userLocation(message.User.ID)).Format("2006/01/02 15:04"))
+		err = PunchInAt(message.User.ID, clock, sourceButton)
+		undo := ""
 		if err != nil {
 			title = fmt.Sprintf(":warning: Error occurred: %s", err)
 			sugar.Errorf("error occurred: %s", err)
+		} else {
+			undo = undoValue(message.User.ID)
 		}
-		responseMessage(w, message.OriginalMessage, title, "")
-		return
+		return responseMessage(message.OriginalMessage, title, "", undo), nil
 	case actionOut:
-		title := fmt.Sprintf(":ok: You have punched out at *%s*.", time.Now().Format("2006/01/02 15:04"))
-		err := PunchOut(message.User.ID)
+		clock, err := actionTime(action.Value, message.ActionTs)
+		if err != nil {
+			return slack.Message{}, fmt.Errorf("invalid time: %s", action.Value)
+		}
+		title := fmt.Sprintf(":ok: You have punched out at *%s*.", clock.In(userLocation(message.User.ID)).Format("2006/01/02 15:04"))
+		err = PunchOutAt(message.User.ID, clock, sourceButton)
+		undo := ""
 		if err != nil {
 			title = fmt.Sprintf(":warning: Error occurred: %s", err)
 			sugar.Errorf("error occurred: %s", err)
+		} else {
+			undo = undoValue(message.User.ID)
 		}
-		responseMessage(w, message.OriginalMessage, title, "")
-		return
+		return responseMessage(message.OriginalMessage, title, "", undo), nil
+	case actionCorrectIn:
+		if len(action.SelectedOptions) == 0 {
+			return slack.Message{}, fmt.Errorf("no time was selected")
+		}
+		clock, err := time.Parse(time.RFC3339, action.SelectedOptions[0].Value)
+		if err != nil {
+			return slack.Message{}, fmt.Errorf("invalid time: %s", action.SelectedOptions[0].Value)
+		}
+		title := fmt.Sprintf(":ok: You have corrected the clock-in to *%s*.", clock.In(userLocation(message.User.ID)).Format("2006/01/02 15:04"))
+		err = CorrectInAt(message.User.ID, clock, sourceButton)
+		undo := ""
+		if err != nil {
+			title = fmt.Sprintf(":warning: Error occurred: %s", err)
+			sugar.Errorf("error occurred: %s", err)
+		} else {
+			undo = undoValue(message.User.ID)
+		}
+		return responseMessage(message.OriginalMessage, title, "", undo), nil
 	case actionLeave:
 		title := ":ok: You are off today. Enjoy :tada:"
-		err := PunchLeave(message.User.ID)
+		err := PunchLeave(message.User.ID, sourceButton)
+		undo := ""
 		if err != nil {
 			title = fmt.Sprintf(":warning: Error occurred: %s", err)
 			sugar.Errorf("error occurred: %s", err)
+		} else {
+			undo = undoValue(message.User.ID)
 		}
-		responseMessage(w, message.OriginalMessage, title, "")
-		return
+		return responseMessage(message.OriginalMessage, title, "", undo), nil
+	case actionSnooze:
+		minutes, err := strconv.Atoi(action.Value)
+		if err != nil {
+			return slack.Message{}, fmt.Errorf("invalid snooze duration: %s", action.Value)
+		}
+		snooze := time.Now().In(userLocation(message.User.ID)).Add(time.Duration(minutes) * time.Minute)
+		title := fmt.Sprintf(":zzz: Snoozed. I will remind you again at *%s*.", snooze.Format("15:04"))
+		err = updateReminder(message.User.ID, func(reminder *Reminder) { reminder.Snooze = snooze })
+		if err != nil {
+			title = fmt.Sprintf(":warning: Error occurred: %s", err)
+			sugar.Errorf("error occurred: %s", err)
+		}
+		return responseMessage(message.OriginalMessage, title, "", ""), nil
+	case actionUndo:
+		var title string
+		change, err := Undo(message.User.ID, action.Value, sourceButton, func(done, total int) {
+			if done < total {
+				progress(fmt.Sprintf(":hourglass_flowing_sand: Undoing... (%d/%d days)", done, total))
+			}
+		})
+		switch {
+		case err != nil:
+			title = fmt.Sprintf(":warning: Error occurred: %s", err)
+			sugar.Errorf("error occurred: %s", err)
+		case change == nil:
+			title = ":warning: The change can no longer be undone."
+		default:
+			title = fmt.Sprintf(":ok: Undid the %s on *%s*.", change.Action, change.Dates())
+		}
+		return responseMessage(message.OriginalMessage, title, "", ""), nil
+	case actionMissedConfirm:
+		day, err := time.ParseInLocation("2006-01-02", action.Value, userLocation(message.User.ID))
+		if err != nil {
+			return slack.Message{}, fmt.Errorf("invalid date: %s", action.Value)
+		}
+		RecordPunch(message.User.ID, day, func(punch *Punch) {
+			punch.Out = punch.PlaceholderOut
+			punch.Unconfirmed = false
+		})
+		title := fmt.Sprintf(":ok: Confirmed the clock-out on *%s*.", day.Format("2006/01/02"))
+		return responseAttachment(message.OriginalMessage, message.AttachmentID, title), nil
+	case actionMissedOut:
+		if len(action.SelectedOptions) == 0 {
+			return slack.Message{}, fmt.Errorf("no time was selected")
+		}
+		clock, err := time.ParseInLocation("2006-01-02 1504", action.SelectedOptions[0].Value, userLocation(message.User.ID))
+		if err != nil {
+			return slack.Message{}, fmt.Errorf("invalid time: %s", action.SelectedOptions[0].Value)
+		}
+		title := fmt.Sprintf(":ok: You have punched out at *%s*.", clock.Format("2006/01/02 15:04"))
+		err = PunchOutAt(message.User.ID, clock, sourceButton)
+		if err != nil {
+			title = fmt.Sprintf(":warning: Error occurred: %s", err)
+			sugar.Errorf("error occurred: %s", err)
+		}
+		return responseAttachment(message.OriginalMessage, message.AttachmentID, title), nil
+	case actionFillUsual, actionMarkOff:
+		day, err := time.ParseInLocation("2006-01-02", action.Value, userLocation(message.User.ID))
+		if err != nil {
+			return slack.Message{}, fmt.Errorf("invalid date: %s", action.Value)
+		}
+		var title string
+		if action.Name == actionFillUsual {
+			var in, out time.Time
+			in, out, err = FillUsualHours(message.User.ID, day, sourceButton)
+			title = fmt.Sprintf(":ok: Recorded *%s-%s* on *%s*.", in.Format("15:04"), out.Format("15:04"), day.Format("2006/01/02"))
+		} else {
+			err = MarkOff(message.User.ID, day, sourceButton)
+			title = fmt.Sprintf(":ok: Marked *%s* as off.", day.Format("2006/01/02"))
+		}
+		if err != nil {
+			title = fmt.Sprintf(":warning: Error occurred: %s", err)
+			sugar.Errorf("error occurred: %s", err)
+		}
+		return responseAttachment(message.OriginalMessage, message.AttachmentID, title), nil
 	case actionCancel:
-		responseMessage(w, message.OriginalMessage, "Operation canceled.", "")
-	default:
-		sugar.Errorf("Invalid action was submitted: %s", action.Name)
-		w.WriteHeader(http.StatusInternalServerError)
+		return responseMessage(message.OriginalMessage, "Operation canceled.", "", ""), nil
 	}
+	return slack.Message{}, fmt.Errorf("invalid action was submitted: %s", action.Name)
 }
 
-func responseMessage(w http.ResponseWriter, original slack.Message, title, value string) {
+// actionTime returns the time given as the value of the button, or when the button was clicked if it has no value.
+func actionTime(value, actionTs string) (time.Time, error) {
+	if value == "" {
+		return slackTime(actionTs), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// responseMessage replaces the message with the result. If undo is the value from undoValue, an Undo button is shown.
+func responseMessage(original slack.Message, title, value, undo string) slack.Message {
+	original.Attachments = original.Attachments[:1]
 	original.Attachments[0].Actions = []slack.AttachmentAction{}
+	if undo != "" {
+		original.Attachments[0].Actions = []slack.AttachmentAction{
+			{
+				Name:  actionUndo,
+				Text:  "Undo",
+				Type:  "button",
+				Value: undo,
+			},
+		}
+	}
 	original.Attachments[0].Fields = []slack.AttachmentField{
 		{
 			Title: title,
@@ -95,10 +381,72 @@ func responseMessage(w http.ResponseWriter, original slack.Message, title, value
 			Short: false,
 		},
 	}
+	return original
+}
 
+// responseAttachment replaces only the attachment which the action was taken on, leaving the others intact.
+func responseAttachment(original slack.Message, attachmentID, title string) slack.Message {
+	index, err := strconv.Atoi(attachmentID)
+	if err != nil || index < 1 || index > len(original.Attachments) {
+		index = 1
+	}
+	original.Attachments[index-1].Actions = []slack.AttachmentAction{}
+	original.Attachments[index-1].Fields = []slack.AttachmentField{
+		{
+			Title: title,
+			Short: false,
+		},
+	}
+	return original
+}
+
+func writeMessage(w http.ResponseWriter, message slack.Message) {
 	w.Header().Add("Content-type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(&original)
+	json.NewEncoder(w).Encode(&message)
+}
+
+// writeEphemeral shows the text only to the user who took the action, leaving the message intact.
+func writeEphemeral(w http.ResponseWriter, text string) {
+	w.Header().Add("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"response_type":    "ephemeral",
+		"replace_original": false,
+		"text":             text,
+	})
+}
+
+// undoValue returns the signed value of the Undo button for the latest change, or "" if there is none.
+func undoValue(userID string) string {
+	id := LastChangeID(userID)
+	if id == "" {
+		return ""
+	}
+	return signValue(userID, actionUndo, id)
+}
+
+// respondURL replaces the original message through the response_url of the action.
+func respondURL(responseURL string, message slack.Message) error {
+	body, err := json.Marshal(struct {
+		slack.Message
+		ReplaceOriginal bool `json:"replace_original"`
+	}{message, true})
+	if err != nil {
+		return err
+	}
+
+	response, err := http.Post(responseURL, "application/json; charset=utf-8", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("response_url returned %d: %s", response.StatusCode, string(data))
+	}
+	return nil
 }
 
 func responseAction(w http.ResponseWriter, original slack.Message, text string, actions []slack.AttachmentAction) {
@@ -111,6 +459,7 @@ func responseAction(w http.ResponseWriter, original slack.Message, text string,
 }
 
 func responseError(w http.ResponseWriter, original slack.Message, title, value string) {
+	original.Attachments = original.Attachments[:1]
 	original.Attachments[0].Actions = []slack.AttachmentAction{}
 	original.Attachments[0].Fields = []slack.AttachmentField{
 		{
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RunDaily calls job every day at the time of day given as HHMM until ctx is canceled.
+func RunDaily(ctx context.Context, at string, job func(now time.Time) error) error {
+	clock, err := time.Parse("1504", at)
+	if err != nil {
+		return fmt.Errorf("invalid time of day '%s': %s", at, err)
+	}
+
+	for {
+		current := now()
+		next := time.Date(current.Year(), current.Month(), current.Day(), clock.Hour(), clock.Minute(), 0, 0, current.Location())
+		if !next.After(current) {
+			next = next.AddDate(0, 0, 1)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(next.Sub(current)):
+		}
+
+		if err := job(next); err != nil {
+			return err
+		}
+	}
+}
+
+// userJobInterval is how often RunDailyForUsers checks the time of day of each user.
+const userJobInterval = 30 * time.Second
+
+// RunDailyForUsers calls job for each user every day at the time of day given as HHMM in the time zone of the user
+// until ctx is canceled. Like RunDaily, a run missed while the bot was stopped is not caught up.
+// The jobs of the users run one by one and may take long, e.g. within the rate limit of the API,
+// so a user whose time passed meanwhile is run as soon as the jobs before are done.
+func RunDailyForUsers(ctx context.Context, at string, job func(user *User, now time.Time) error) error {
+	clock, err := time.Parse("1504", at)
+	if err != nil {
+		return fmt.Errorf("invalid time of day '%s': %s", at, err)
+	}
+
+	started := time.Now()
+	done := map[string]string{}
+	for {
+		users, err := AllUsers()
+		if err != nil {
+			return fmt.Errorf("failed to load users: %s", err)
+		}
+
+		current := time.Now()
+		for _, user := range users {
+			local := current.In(user.Location())
+			scheduled := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, local.Location())
+			day := local.Format("2006-01-02")
+			if local.Before(scheduled) || done[user.SlackUserID] == day {
+				continue
+			}
+			// The time passed before the bot started.
+			if started.Sub(scheduled) >= 2*userJobInterval {
+				continue
+			}
+			done[user.SlackUserID] = day
+			if err := job(user, scheduled); err != nil {
+				sugar.Errorf("Failed to run the daily job at %s [%s]: %s", at, user.SlackUserID, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(userJobInterval):
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const (
+	leaseDir = "locks"
+
+	leaseDuration      = 30 * time.Second
+	leaseRenewInterval = 10 * time.Second
+)
+
+var errLeaseBusy = fmt.Errorf("the lease is being updated by another replica")
+
+// Lease is stored in the shared store next to the user data.
+// Only the replica holding an unexpired lease runs the scheduled jobs.
+type Lease struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type LeaderElector struct {
+	id   string
+	name string
+}
+
+func NewLeaderElector(name string) *LeaderElector {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return &LeaderElector{
+		id:   fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		name: name,
+	}
+}
+
+// Run campaigns for the leadership until ctx is canceled. lead is called whenever this replica becomes
+// the leader and must start its jobs without blocking. Their context is canceled as soon as the leadership is lost.
+func (e *LeaderElector) Run(ctx context.Context, lead func(ctx context.Context)) error {
+	var cancel context.CancelFunc
+	var renewedAt time.Time
+	defer func() {
+		if cancel != nil {
+			cancel()
+			e.release()
+		}
+	}()
+
+	for {
+		acquired, err := e.acquire()
+		if err != nil && err != errLeaseBusy {
+			sugar.Errorf("Failed to acquire the lease '%s': %s", e.name, err)
+		}
+
+		if acquired {
+			renewedAt = time.Now()
+		}
+
+		if acquired && cancel == nil {
+			sugar.Infof("Became the leader of '%s' [%s]", e.name, e.id)
+			cancel = startLeading(ctx, lead)
+		} else if !acquired && cancel != nil && (err != errLeaseBusy || time.Since(renewedAt) >= leaseDuration) {
+			sugar.Warnf("Lost the leadership of '%s' [%s]", e.name, e.id)
+			cancel()
+			cancel = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(leaseRenewInterval):
+		}
+	}
+}
+
+func startLeading(ctx context.Context, lead func(ctx context.Context)) context.CancelFunc {
+	leadCtx, cancel := context.WithCancel(ctx)
+	lead(leadCtx)
+	return cancel
+}
+
+func (e *LeaderElector) acquire() (bool, error) {
+	acquired := false
+	err := e.withLock(func() error {
+		lease, err := e.read()
+		if err != nil {
+			return err
+		}
+		if lease.Holder != e.id && time.Now().Before(lease.ExpiresAt) {
+			return nil
+		}
+
+		acquired = true
+		return e.write(Lease{Holder: e.id, ExpiresAt: time.Now().Add(leaseDuration)})
+	})
+	if err != nil {
+		return false, err
+	}
+	return acquired, nil
+}
+
+func (e *LeaderElector) release() {
+	err := e.withLock(func() error {
+		lease, err := e.read()
+		if err != nil || lease.Holder != e.id {
+			return err
+		}
+		return e.write(Lease{})
+	})
+	if err != nil {
+		sugar.Warnf("Failed to release the lease '%s': %s", e.name, err)
+	}
+}
+
+func (e *LeaderElector) read() (Lease, error) {
+	var lease Lease
+	data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", leaseDir, e.name))
+	if os.IsNotExist(err) {
+		return lease, nil
+	}
+	if err != nil {
+		return lease, err
+	}
+	if err := json.Unmarshal(data, &lease); err != nil {
+		sugar.Warnf("Discard broken lease '%s': %s", e.name, err)
+		return Lease{}, nil
+	}
+	return lease, nil
+}
+
+func (e *LeaderElector) write(lease Lease) error {
+	text, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("%s/%s", leaseDir, e.name)
+	if err := ioutil.WriteFile(path+".tmp", text, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// withLock serializes the read-modify-write of the lease between replicas with an exclusively created lock file.
+func (e *LeaderElector) withLock(fn func() error) error {
+	if err := os.MkdirAll(leaseDir, 0755); err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("%s/%s.lock", leaseDir, e.name)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if os.IsExist(err) {
+		// The lock file is left behind when a replica crashed while holding it.
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > leaseDuration {
+			os.Remove(path)
+		}
+		return errLeaseBusy
+	}
+	if err != nil {
+		return err
+	}
+	file.Close()
+	defer os.Remove(path)
+
+	return fn()
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/nlopes/slack"
 	"github.com/urfave/cli"
 	"go.uber.org/zap"
 	"net/http"
 	"os"
+	"time"
 )
 
 var (
@@ -38,18 +40,86 @@ func _main(_ []string) int {
 
 		clientID = config.OAuthClientID
 		clientSecret = config.OAuthClientSecret
+		ConfigureRoles(config.Owners, config.Admins)
+		buttonSecret = []byte(config.ButtonSecret)
+		undoWindow, err = time.ParseDuration(config.UndoWindow)
+		if err != nil {
+			return fmt.Errorf("invalid undo_window: %s", err)
+		}
+		boundary, err := time.Parse("1504", config.DayBoundary)
+		if err != nil {
+			return fmt.Errorf("invalid day_boundary: %s", err)
+		}
+		dayBoundary = time.Duration(boundary.Hour())*time.Hour + time.Duration(boundary.Minute())*time.Minute
+
+		if err := ImportTeams(config.Teams); err != nil {
+			return fmt.Errorf("failed to import teams: %s", err)
+		}
 
 		sugar.Infof("Start slack event listening")
+		ctx := context.Background()
+		supervisor := NewSupervisor()
 		client := slack.New(config.BotToken)
 		slackListener := &SlackListener{
-			client: client,
-			botID:  config.BotID,
+			client:     client,
+			botID:      config.BotID,
+			supervisor: supervisor,
 		}
-		go slackListener.ListenAndResponse()
-		go slackListener.sendReminderMessage()
+		scheduler := NewScheduler(systemClock{}, slackListener.deliverReminder)
+		userChanged = scheduler.Update
+
+		// Only the leader listens to RTM events and runs the scheduled jobs.
+		// Every replica serves the HTTP endpoints.
+		elector := NewLeaderElector("leader")
+		supervisor.Go(ctx, "leader", func(ctx context.Context) error {
+			return elector.Run(ctx, func(ctx context.Context) {
+				supervisor.Go(ctx, "rtm", slackListener.ListenAndResponse)
+				supervisor.Go(ctx, "reminder", func(ctx context.Context) error {
+					users, err := AllUsers()
+					if err != nil {
+						return fmt.Errorf("failed to load users: %s", err)
+					}
+					slackListener.fillTimeZones(users)
+					scheduler.Load(users)
+					return scheduler.Run(ctx)
+				})
+				supervisor.Go(ctx, "user-watch", func(ctx context.Context) error {
+					return WatchUsers(ctx, 30*time.Second, scheduler.Update)
+				})
+				supervisor.Go(ctx, "missed-punch", func(ctx context.Context) error {
+					return RunDailyForUsers(ctx, config.MissedPunchDetectAt, DetectMissedPunchOut)
+				})
+				supervisor.Go(ctx, "missed-punch-follow-up", func(ctx context.Context) error {
+					return RunDailyForUsers(ctx, config.MissedPunchFollowUpAt, slackListener.followUpMissedPunches)
+				})
+				supervisor.Go(ctx, "month-close", func(ctx context.Context) error {
+					return RunDailyForUsers(ctx, config.MonthCloseAt, slackListener.sendMonthCloseReminders(config.MonthCloseDays))
+				})
+				supervisor.Go(ctx, "digest", func(ctx context.Context) error {
+					return RunDaily(ctx, config.DigestAt, slackListener.sendDigests)
+				})
+				supervisor.Go(ctx, "dedupe-prune", func(ctx context.Context) error {
+					return RunDaily(ctx, "0400", PruneDedupe)
+				})
+			})
+		})
+
+		// Every replica processes the actions clicked on the buttons which it received.
+		supervisor.Go(ctx, "action-worker", func(ctx context.Context) error {
+			return RunActionWorkers(ctx, actionWorkers)
+		})
 
 		http.Handle("/interaction", interactionHandler{
 			slackClient:       client,
+			botToken:          config.BotToken,
+			verificationToken: config.VerificationToken,
+		})
+		http.Handle("/status", statusHandler{
+			supervisor:        supervisor,
+			verificationToken: config.VerificationToken,
+		})
+		http.Handle("/events", eventHandler{
+			botToken:          config.BotToken,
 			verificationToken: config.VerificationToken,
 		})
 
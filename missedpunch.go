@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	actionMissedConfirm = "missed_confirm"
+	actionMissedOut     = "missed_out"
+
+	missedPunchCallbackID = "missed_punch"
+)
+
+// DetectMissedPunchOut marks the day if the user punched in but the clock-out is missing
+// or still the placeholder written on punch in. date is the time of day in the time zone of the user.
+func DetectMissedPunchOut(user *User, date time.Time) error {
+	missed, err := isMissedPunchOut(user.SlackUserID, date)
+	if err != nil {
+		return fmt.Errorf("failed to check the punch-out on %s: %s", date.Format("2006/01/02"), err)
+	}
+	if missed {
+		RecordPunch(user.SlackUserID, date, func(punch *Punch) {
+			punch.Unconfirmed = true
+			punch.FollowedUp = false
+		})
+	}
+	return nil
+}
+
+func isMissedPunchOut(userID string, date time.Time) (bool, error) {
+	punch := FindPunchLog(userID).Get(date)
+	if !punch.Out.IsZero() {
+		return false, nil
+	}
+
+	record, err := WorkRecord(userID, date)
+	if err != nil {
+		return false, err
+	}
+	if record["day_pattern"] != "normal_day" || record["clock_in_at"] == nil {
+		return false, nil
+	}
+	if isAbsence, _ := record["is_absence"].(bool); isAbsence {
+		return false, nil
+	}
+	if record["clock_out_at"] == nil {
+		return true, nil
+	}
+
+	clockOut, err := time.Parse(time.RFC3339, fmt.Sprint(record["clock_out_at"]))
+	if err != nil {
+		return false, err
+	}
+	return !punch.PlaceholderOut.IsZero() && clockOut.Equal(punch.PlaceholderOut), nil
+}
+
+// followUpMissedPunches asks the user to confirm or correct the clock-out of the days marked by DetectMissedPunchOut.
+func (s *SlackListener) followUpMissedPunches(user *User, now time.Time) error {
+	punchLog := FindPunchLog(user.SlackUserID)
+	dates := []string{}
+	for date, punch := range punchLog.Days {
+		if punch.Unconfirmed && !punch.FollowedUp {
+			dates = append(dates, date)
+		}
+	}
+	if len(dates) == 0 {
+		return nil
+	}
+	sort.Strings(dates)
+
+	location := user.Location()
+	attachments := []slack.Attachment{}
+	for _, date := range dates {
+		attachments = append(attachments, missedPunchAttachment(date, punchLog.Days[date], location))
+	}
+	parameters := slack.PostMessageParameters{
+		Attachments: attachments,
+	}
+	text := "It seems you forgot to punch out on the following days. Please confirm the time or enter the real one."
+	if _, _, err := s.client.PostMessage(user.SlackChannelID, text, signActions(user.SlackUserID, parameters)); err != nil {
+		return fmt.Errorf("failed to follow up the missed punch-outs: %s", err)
+	}
+
+	for _, date := range dates {
+		day, _ := time.ParseInLocation("2006-01-02", date, location)
+		RecordPunch(user.SlackUserID, day, func(punch *Punch) { punch.FollowedUp = true })
+	}
+	return nil
+}
+
+// missedPunchAttachment shows the day and the times to choose in the time zone of the user.
+func missedPunchAttachment(date string, punch Punch, location *time.Location) slack.Attachment {
+	day, _ := time.ParseInLocation("2006-01-02", date, location)
+
+	in := "--:--"
+	if !punch.In.IsZero() {
+		in = punch.In.In(location).Format("15:04")
+	}
+	out := "--:--"
+	actions := []slack.AttachmentAction{}
+	if !punch.PlaceholderOut.IsZero() {
+		out = fmt.Sprintf("%s (filled in automatically)", punch.PlaceholderOut.In(location).Format("15:04"))
+		actions = append(actions, slack.AttachmentAction{
+			Name:  actionMissedConfirm,
+			Text:  "Confirm",
+			Type:  "button",
+			Style: "primary",
+			Value: date,
+		})
+	}
+
+	options := []slack.AttachmentActionOption{}
+	for t := day.Add(15 * time.Hour); t.Before(day.AddDate(0, 0, 1)); t = t.Add(30 * time.Minute) {
+		options = append(options, slack.AttachmentActionOption{
+			Text:  t.Format("15:04"),
+			Value: t.Format("2006-01-02 1504"),
+		})
+	}
+	actions = append(actions, slack.AttachmentAction{
+		Name:    actionMissedOut,
+		Text:    "Enter the real time",
+		Type:    "select",
+		Options: options,
+	})
+
+	return slack.Attachment{
+		Text:       fmt.Sprintf("%s  In: %s  Out: %s", day.Format("2006/01/02 (Mon)"), in, out),
+		CallbackID: missedPunchCallbackID,
+		Actions:    actions,
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	actionFillUsual = "fill_usual"
+	actionMarkOff   = "mark_off"
+
+	monthCloseCallbackID = "month_close"
+)
+
+type problemDay struct {
+	Date   time.Time
+	Reason string
+}
+
+// isMonthCloseDay reports whether the date is one of the given number of business days before the last business day of the month.
+func isMonthCloseDay(date time.Time, days []int) bool {
+	last := time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, date.Location())
+	for !isBusinessDay(last) {
+		last = last.AddDate(0, 0, -1)
+	}
+
+	for _, before := range days {
+		day := last
+		for i := 0; i < before; {
+			day = day.AddDate(0, 0, -1)
+			if isBusinessDay(day) {
+				i++
+			}
+		}
+		if day.Year() == date.Year() && day.YearDay() == date.YearDay() {
+			return true
+		}
+	}
+	return false
+}
+
+func isBusinessDay(date time.Time) bool {
+	return date.Weekday() != time.Saturday && date.Weekday() != time.Sunday
+}
+
+// sendMonthCloseReminders returns the job to send the reminder to a user on the closing days in the time zone of the user.
+func (s *SlackListener) sendMonthCloseReminders(days []int) func(user *User, now time.Time) error {
+	return func(user *User, now time.Time) error {
+		if !isMonthCloseDay(now, days) {
+			return nil
+		}
+		if err := s.sendMonthCloseReminder(user, now); err != nil {
+			return fmt.Errorf("failed to send the month-end closing reminder: %s", err)
+		}
+		return nil
+	}
+}
+
+func (s *SlackListener) sendMonthCloseReminder(user *User, now time.Time) error {
+	days, err := problemDays(user.SlackUserID, now)
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf(":calendar: The timesheet of %s will be closed soon.", now.Format("2006/01"))
+	if len(days) == 0 {
+		_, _, err := s.client.PostMessage(user.SlackChannelID, text+" All days are complete. Thank you :tada:", slack.NewPostMessageParameters())
+		return err
+	}
+
+	attachments := []slack.Attachment{}
+	for _, day := range days {
+		attachments = append(attachments, slack.Attachment{
+			Text:       fmt.Sprintf("%s  %s", day.Date.Format("2006/01/02 (Mon)"), day.Reason),
+			CallbackID: monthCloseCallbackID,
+			Actions: []slack.AttachmentAction{
+				{
+					Name:  actionFillUsual,
+					Text:  "Fill with my usual hours",
+					Type:  "button",
+					Style: "primary",
+					Value: day.Date.Format("2006-01-02"),
+				},
+				{
+					Name:  actionMarkOff,
+					Text:  "Mark off",
+					Type:  "button",
+					Style: "danger",
+					Value: day.Date.Format("2006-01-02"),
+				},
+			},
+		})
+	}
+	parameters := slack.PostMessageParameters{
+		Attachments: attachments,
+	}
+	_, _, err = s.client.PostMessage(user.SlackChannelID, text+" Please fix the following days.", signActions(user.SlackUserID, parameters))
+	return err
+}
+
+// problemDays returns the incomplete or inconsistent days of the month before today.
+func problemDays(userID string, now time.Time) ([]problemDay, error) {
+	records, err := BulkMonthRecords(userID, now)
+	if err != nil {
+		return nil, err
+	}
+	punchLog := FindPunchLog(userID)
+
+	days := []problemDay{}
+	for _, record := range records {
+		date, err := time.ParseInLocation("2006-01-02", fmt.Sprint(record["date"]), now.Location())
+		if err != nil || date.Day() == now.Day() {
+			continue
+		}
+		if record["day_pattern"] != "normal_day" {
+			continue
+		}
+		if isAbsence, _ := record["is_absence"].(bool); isAbsence {
+			continue
+		}
+
+		switch {
+		case record["clock_in_at"] == nil && record["clock_out_at"] == nil:
+			days = append(days, problemDay{Date: date, Reason: "No record"})
+		case record["clock_in_at"] == nil:
+			days = append(days, problemDay{Date: date, Reason: "Missing clock-in"})
+		case record["clock_out_at"] == nil:
+			days = append(days, problemDay{Date: date, Reason: "Missing clock-out"})
+		case workDuration(record) == 0:
+			days = append(days, problemDay{Date: date, Reason: "Clock-out is before clock-in"})
+		case punchLog.Get(date).Unconfirmed:
+			days = append(days, problemDay{Date: date, Reason: "Clock-out was filled in automatically"})
+		}
+	}
+	return days, nil
+}
+
+// FillUsualHours records the reminder times of the weekday as the working hours of the day.
+func FillUsualHours(userID string, date time.Time, source string) (time.Time, time.Time, error) {
+	user, err := FindUser(userID)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	am, pm, ok := user.Reminder.On(date.Weekday())
+	if !ok {
+		am, pm = user.Reminder.AM, user.Reminder.PM
+	}
+	record := map[string]interface{}{
+		"date": date.Format("2006-01-02"),
+		"in":   am.Format("1504"),
+		"out":  pm.Format("1504"),
+	}
+	if err := BulkUpdate(userID, []map[string]interface{}{record}, source); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return am, pm, nil
+}
+
+func MarkOff(userID string, date time.Time, source string) error {
+	record := map[string]interface{}{
+		"date": date.Format("2006-01-02"),
+		"off":  true,
+	}
+	return BulkUpdate(userID, []map[string]interface{}{record}, source)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	punchLogDir = "punches"
+
+	punchRetention = 62 * 24 * time.Hour
+)
+
+var punchLogMutex sync.Mutex
+
+// PunchLog keeps the punches made through the bot, so that we can tell
+// the real clock-out time from the placeholder written on punch in.
+type PunchLog struct {
+	SlackUserID string           `json:"slack_user_id"`
+	Days        map[string]Punch `json:"days"`
+}
+
+type Punch struct {
+	In             time.Time `json:"in"`
+	Out            time.Time `json:"out"`
+	PlaceholderOut time.Time `json:"placeholder_out"`
+
+	// Unconfirmed is set when the clock-out seems to be forgotten, until the user confirms or corrects it.
+	Unconfirmed bool `json:"unconfirmed"`
+	FollowedUp  bool `json:"followed_up"`
+}
+
+func FindPunchLog(userID string) *PunchLog {
+	log := PunchLog{
+		SlackUserID: userID,
+		Days:        map[string]Punch{},
+	}
+
+	data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", punchLogDir, userID))
+	if err != nil {
+		return &log
+	}
+	if err := json.Unmarshal(data, &log); err != nil {
+		sugar.Warnf("Discard broken punch log [%s]: %s", userID, err)
+		return &PunchLog{SlackUserID: userID, Days: map[string]Punch{}}
+	}
+	if log.Days == nil {
+		log.Days = map[string]Punch{}
+	}
+
+	return &log
+}
+
+func (l *PunchLog) Get(date time.Time) Punch {
+	return l.Days[date.Format("2006-01-02")]
+}
+
+func (l *PunchLog) Save() error {
+	for date := range l.Days {
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil || time.Since(day) > punchRetention {
+			delete(l.Days, date)
+		}
+	}
+
+	text, err := json.Marshal(*l)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(punchLogDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(fmt.Sprintf("%s/%s", punchLogDir, l.SlackUserID), text)
+}
+
+func RecordPunch(userID string, date time.Time, update func(punch *Punch)) {
+	punchLogMutex.Lock()
+	defer punchLogMutex.Unlock()
+
+	err := withFileLock(fmt.Sprintf("%s/%s", punchLogDir, userID), func() error {
+		log := FindPunchLog(userID)
+		punch := log.Get(date)
+		update(&punch)
+		log.Days[date.Format("2006-01-02")] = punch
+		return log.Save()
+	})
+	if err != nil {
+		sugar.Warnf("Failed to save punch log [%s]: %s", userID, err)
+	}
+}
+
+// alreadyPunched reports whether the reminder is redundant because the punch it asks for is already recorded.
+func alreadyPunched(userID string, record map[string]interface{}, morning bool) bool {
+	if isAbsence, _ := record["is_absence"].(bool); isAbsence {
+		return true
+	}
+
+	date, err := time.Parse("2006-01-02", fmt.Sprint(record["date"]))
+	if err != nil {
+		return false
+	}
+	punch := FindPunchLog(userID).Get(date)
+
+	if morning {
+		return !punch.In.IsZero() || record["clock_in_at"] != nil
+	}
+
+	if !punch.Out.IsZero() {
+		return true
+	}
+	if record["clock_out_at"] == nil {
+		return false
+	}
+	clockOut, err := time.Parse(time.RFC3339, fmt.Sprint(record["clock_out_at"]))
+	if err != nil {
+		return false
+	}
+	return punch.PlaceholderOut.IsZero() || !clockOut.Equal(punch.PlaceholderOut)
+}
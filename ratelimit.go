@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// The API of freee allows 5000 requests per hour. The background jobs which fetch the records of many users,
+// e.g. the team reports, have their own share of it so that they never starve the requests of the users.
+var (
+	apiLimiter  = newRateLimiter(4000, time.Hour, 100)
+	bulkLimiter = newRateLimiter(1000, time.Hour, 20)
+)
+
+// rateLimiter is a token bucket which allows a burst of requests up to the capacity.
+type rateLimiter struct {
+	mutex    sync.Mutex
+	tokens   float64
+	capacity float64
+	rate     float64
+	last     time.Time
+}
+
+func newRateLimiter(count int, per time.Duration, capacity int) *rateLimiter {
+	return &rateLimiter{
+		tokens:   float64(capacity),
+		capacity: float64(capacity),
+		rate:     float64(count) / per.Seconds(),
+		last:     time.Now(),
+	}
+}
+
+// Wait blocks until a request is allowed.
+func (l *rateLimiter) Wait() {
+	l.mutex.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.capacity {
+		l.tokens = l.capacity
+	}
+	l.last = now
+	l.tokens--
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mutex.Unlock()
+
+	time.Sleep(wait)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	reminderAM     = "am"
+	reminderPM     = "pm"
+	reminderSnooze = "snooze"
+
+	// Reminders which could not be fired on time (e.g. the bot was down) are still sent within the grace period.
+	// After that, the user is told that the reminder was missed if it is still the same day.
+	reminderGracePeriod = 10 * time.Minute
+	// Reminders due at the same time are sent one by one to spread the API requests.
+	reminderSpacing = 200 * time.Millisecond
+)
+
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type ReminderEntry struct {
+	UserID string
+	Kind   string
+	FireAt time.Time
+	Late   bool
+}
+
+type reminderQueue []ReminderEntry
+
+func (q reminderQueue) Len() int           { return len(q) }
+func (q reminderQueue) Less(i, j int) bool { return q[i].FireAt.Before(q[j].FireAt) }
+func (q reminderQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *reminderQueue) Push(x interface{}) {
+	*q = append(*q, x.(ReminderEntry))
+}
+
+func (q *reminderQueue) Pop() interface{} {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// Scheduler keeps the upcoming reminders of all users in a time-ordered queue
+// and fires each of them when it is due.
+type Scheduler struct {
+	clock       Clock
+	find        func(userID string) (*User, error)
+	deliver     func(entry ReminderEntry) (bool, error)
+	deliveries  DeliveryStore
+	recordError func(userID string, cause error)
+	grace       time.Duration
+	spacing     time.Duration
+
+	mutex sync.Mutex
+	queue reminderQueue
+	wake  chan struct{}
+}
+
+// NewScheduler creates a scheduler. deliver returns false if the reminder turned out to be unnecessary.
+func NewScheduler(clock Clock, deliver func(entry ReminderEntry) (bool, error)) *Scheduler {
+	return &Scheduler{
+		clock:       clock,
+		find:        FindUser,
+		deliver:     deliver,
+		deliveries:  fileDeliveryStore{},
+		recordError: RecordError,
+		grace:       reminderGracePeriod,
+		spacing:     reminderSpacing,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Load rebuilds the queue from the users. Today's reminders which were not delivered yet are caught up.
+func (s *Scheduler) Load(users []*User) {
+	now := s.clock.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if now.Add(-s.grace).Before(from) {
+		from = now.Add(-s.grace)
+	}
+	queue := reminderQueue{}
+	for _, user := range users {
+		queue = append(queue, upcomingReminders(user, from)...)
+	}
+	heap.Init(&queue)
+
+	s.mutex.Lock()
+	s.queue = queue
+	s.mutex.Unlock()
+	s.notify()
+}
+
+// Update reschedules the reminders of the user after the settings were changed or the user was removed.
+func (s *Scheduler) Update(userID string) {
+	s.mutex.Lock()
+	queue := reminderQueue{}
+	for _, entry := range s.queue {
+		if entry.UserID != userID {
+			queue = append(queue, entry)
+		}
+	}
+	if user, err := s.find(userID); err == nil {
+		queue = append(queue, upcomingReminders(user, s.clock.Now())...)
+	}
+	heap.Init(&queue)
+	s.queue = queue
+	s.mutex.Unlock()
+	s.notify()
+}
+
+// Upcoming returns a copy of the queued reminders.
+func (s *Scheduler) Upcoming() []ReminderEntry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries := make([]ReminderEntry, len(s.queue))
+	copy(entries, s.queue)
+	return entries
+}
+
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		s.mutex.Lock()
+		now := s.clock.Now()
+		due := []ReminderEntry{}
+		for s.queue.Len() > 0 && !s.queue[0].FireAt.After(now) {
+			due = append(due, heap.Pop(&s.queue).(ReminderEntry))
+		}
+		wait := time.Hour
+		if s.queue.Len() > 0 {
+			wait = s.queue[0].FireAt.Sub(now)
+		}
+		s.mutex.Unlock()
+
+		if len(due) > 0 {
+			for i, entry := range due {
+				if i > 0 {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-s.clock.After(s.spacing):
+					}
+				}
+				s.fire(entry)
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.wake:
+		case <-s.clock.After(wait):
+		}
+	}
+}
+
+func (s *Scheduler) fire(entry ReminderEntry) {
+	// A failure for one user must not stop the reminders of the others.
+	defer func() {
+		if r := recover(); r != nil {
+			sugar.Errorf("Panic while sending the %s reminder [%s]: %v", entry.Kind, entry.UserID, r)
+		}
+	}()
+
+	if s.deliveries.Delivered(entry) {
+		sugar.Infof("The %s reminder at %s was already delivered [%s]", entry.Kind, entry.FireAt.Format("2006/01/02 15:04"), entry.UserID)
+	} else {
+		now := s.clock.Now()
+		delay := now.Sub(entry.FireAt)
+		if delay > s.grace && (entry.Kind == reminderSnooze || entry.FireAt.Format("2006-01-02") != now.In(entry.FireAt.Location()).Format("2006-01-02")) {
+			sugar.Warnf("Missed the %s reminder at %s [%s]", entry.Kind, entry.FireAt.Format("2006/01/02 15:04"), entry.UserID)
+			s.deliveries.Record(entry, deliveryMissed, nil)
+		} else {
+			entry.Late = delay > s.grace
+			sent, err := s.deliver(entry)
+			switch {
+			case err != nil:
+				sugar.Errorf("Failed to send the %s reminder [%s]: %s", entry.Kind, entry.UserID, err)
+				s.deliveries.Record(entry, deliveryFailed, err)
+				s.recordError(entry.UserID, err)
+			case !sent:
+				s.deliveries.Record(entry, deliverySkipped, nil)
+			case entry.Late:
+				s.deliveries.Record(entry, deliveryLate, nil)
+			default:
+				s.deliveries.Record(entry, deliverySent, nil)
+			}
+		}
+	}
+
+	if entry.Kind != reminderSnooze {
+		s.Update(entry.UserID)
+	}
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// upcomingReminders returns the next reminders of the user after from.
+func upcomingReminders(user *User, from time.Time) []ReminderEntry {
+	// The reminder times are in the time zone of the user.
+	from = from.In(user.Location())
+	entries := []ReminderEntry{}
+	reminder := user.Reminder
+	if reminder.Snooze.After(from) {
+		entries = append(entries, ReminderEntry{UserID: user.SlackUserID, Kind: reminderSnooze, FireAt: reminder.Snooze})
+	}
+	if !reminder.Enabled {
+		return entries
+	}
+
+	for _, kind := range []string{reminderAM, reminderPM} {
+		for i := 0; i <= 7; i++ {
+			day := from.AddDate(0, 0, i)
+			am, pm, ok := reminder.On(day.Weekday())
+			if !ok {
+				continue
+			}
+			clock := am
+			if kind == reminderPM {
+				clock = pm
+			}
+			fireAt := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, from.Location())
+			if !fireAt.After(from) {
+				continue
+			}
+			entries = append(entries, ReminderEntry{UserID: user.SlackUserID, Kind: kind, FireAt: fireAt})
+			break
+		}
+	}
+	return entries
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func init() {
+	sugar = zap.NewNop().Sugar()
+}
+
+type fakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	waiters := []fakeWaiter{}
+	for _, waiter := range c.waiters {
+		if waiter.at.After(c.now) {
+			waiters = append(waiters, waiter)
+			continue
+		}
+		waiter.ch <- c.now
+	}
+	c.waiters = waiters
+}
+
+type memoryDeliveryStore struct {
+	mutex    sync.Mutex
+	statuses map[string]string
+}
+
+func (s *memoryDeliveryStore) key(entry ReminderEntry) string {
+	return fmt.Sprintf("%s %s %s", entry.UserID, entry.Kind, entry.FireAt.Format(time.RFC3339))
+}
+
+func (s *memoryDeliveryStore) Delivered(entry ReminderEntry) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status := s.statuses[s.key(entry)]
+	return status == deliverySent || status == deliveryLate || status == deliverySkipped
+}
+
+func (s *memoryDeliveryStore) Record(entry ReminderEntry, status string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.statuses[s.key(entry)] = status
+}
+
+func (s *memoryDeliveryStore) Status(entry ReminderEntry) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.statuses[s.key(entry)]
+}
+
+type schedulerFixture struct {
+	clock      *fakeClock
+	scheduler  *Scheduler
+	deliveries *memoryDeliveryStore
+	delivered  chan ReminderEntry
+	errors     chan string
+
+	mutex sync.Mutex
+	users map[string]*User
+}
+
+func newSchedulerFixture(now time.Time, deliver func(entry ReminderEntry) (bool, error)) *schedulerFixture {
+	f := &schedulerFixture{
+		clock:      &fakeClock{now: now},
+		deliveries: &memoryDeliveryStore{statuses: map[string]string{}},
+		delivered:  make(chan ReminderEntry, 10),
+		errors:     make(chan string, 10),
+		users:      map[string]*User{},
+	}
+	if deliver == nil {
+		deliver = func(entry ReminderEntry) (bool, error) { return true, nil }
+	}
+	f.scheduler = NewScheduler(f.clock, func(entry ReminderEntry) (bool, error) {
+		sent, err := deliver(entry)
+		f.delivered <- entry
+		return sent, err
+	})
+	f.scheduler.find = f.find
+	f.scheduler.deliveries = f.deliveries
+	f.scheduler.recordError = func(userID string, cause error) { f.errors <- userID }
+	f.scheduler.spacing = 0
+	return f
+}
+
+func (f *schedulerFixture) find(userID string) (*User, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	user, ok := f.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("cannot find the user '%s'", userID)
+	}
+	return user, nil
+}
+
+func (f *schedulerFixture) setUser(user *User) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.users[user.SlackUserID] = user
+}
+
+func (f *schedulerFixture) removeUser(userID string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.users, userID)
+}
+
+// next advances the clock minute by minute until a reminder is delivered.
+func (f *schedulerFixture) next(t *testing.T, limit time.Duration) ReminderEntry {
+	t.Helper()
+	for advanced := time.Duration(0); advanced <= limit; {
+		select {
+		case entry := <-f.delivered:
+			return entry
+		case <-time.After(2 * time.Millisecond):
+			f.clock.Advance(time.Minute)
+			advanced += time.Minute
+		}
+	}
+	t.Fatalf("no reminder was delivered in %s", limit)
+	return ReminderEntry{}
+}
+
+func (f *schedulerFixture) run(t *testing.T) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.scheduler.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func testUser(userID string, am, pm string) *User {
+	amTime, _ := time.Parse("1504", am)
+	pmTime, _ := time.Parse("1504", pm)
+	return &User{
+		SlackUserID: userID,
+		Reminder:    Reminder{Enabled: true, AM: amTime, PM: pmTime},
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	// Friday
+	start := time.Date(2018, 8, 17, 8, 0, 0, 0, JST())
+	f := newSchedulerFixture(start, nil)
+	user := testUser("U1", "0900", "1800")
+	f.setUser(user)
+	f.scheduler.Load([]*User{user})
+	defer f.run(t)()
+
+	am := f.next(t, 2*time.Hour)
+	if am.Kind != reminderAM || !am.FireAt.Equal(time.Date(2018, 8, 17, 9, 0, 0, 0, JST())) || am.Late {
+		t.Errorf("first reminder = %+v, want the AM reminder at 09:00 on time", am)
+	}
+	if delay := f.clock.Now().Sub(am.FireAt); delay > 2*time.Minute {
+		t.Errorf("the AM reminder was delivered %s late", delay)
+	}
+
+	pm := f.next(t, 10*time.Hour)
+	if pm.Kind != reminderPM || !pm.FireAt.Equal(time.Date(2018, 8, 17, 18, 0, 0, 0, JST())) || pm.Late {
+		t.Errorf("second reminder = %+v, want the PM reminder at 18:00 on time", pm)
+	}
+	if status := f.deliveries.Status(pm); status != deliverySent {
+		t.Errorf("status of the PM reminder = %q, want %q", status, deliverySent)
+	}
+
+	// The AM reminder was rescheduled to the next day after it was fired.
+	found := false
+	for _, entry := range f.scheduler.Upcoming() {
+		if entry.Kind == reminderAM && entry.FireAt.Equal(time.Date(2018, 8, 18, 9, 0, 0, 0, JST())) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("the AM reminder of the next day is not scheduled: %+v", f.scheduler.Upcoming())
+	}
+}
+
+func TestSchedulerLoadCatchesUp(t *testing.T) {
+	tests := []struct {
+		now  time.Time
+		late bool
+	}{
+		// Within the grace period, the reminder is sent as if it were on time.
+		{time.Date(2018, 8, 17, 9, 5, 0, 0, JST()), false},
+		// After the grace period, the reminder is still sent on the same day but marked as late.
+		{time.Date(2018, 8, 17, 9, 30, 0, 0, JST()), true},
+	}
+	for _, test := range tests {
+		f := newSchedulerFixture(test.now, nil)
+		user := testUser("U1", "0900", "1800")
+		f.setUser(user)
+		f.scheduler.Load([]*User{user})
+		stop := f.run(t)
+
+		entry := f.next(t, time.Minute)
+		stop()
+		if entry.Kind != reminderAM || !entry.FireAt.Equal(time.Date(2018, 8, 17, 9, 0, 0, 0, JST())) {
+			t.Errorf("at %s: caught up %+v, want the AM reminder at 09:00", test.now.Format("15:04"), entry)
+		}
+		if entry.Late != test.late {
+			t.Errorf("at %s: late = %v, want %v", test.now.Format("15:04"), entry.Late, test.late)
+		}
+		want := deliverySent
+		if test.late {
+			want = deliveryLate
+		}
+		if status := f.deliveries.Status(entry); status != want {
+			t.Errorf("at %s: status = %q, want %q", test.now.Format("15:04"), status, want)
+		}
+	}
+}
+
+func TestSchedulerLoadSkipsDelivered(t *testing.T) {
+	now := time.Date(2018, 8, 17, 9, 5, 0, 0, JST())
+	f := newSchedulerFixture(now, nil)
+	user := testUser("U1", "0900", "1800")
+	f.setUser(user)
+	// Delivered before a restart.
+	f.deliveries.Record(ReminderEntry{UserID: "U1", Kind: reminderAM, FireAt: time.Date(2018, 8, 17, 9, 0, 0, 0, JST())}, deliverySent, nil)
+	f.scheduler.Load([]*User{user})
+	defer f.run(t)()
+
+	entry := f.next(t, 10*time.Hour)
+	if entry.Kind != reminderPM {
+		t.Errorf("delivered %+v, want only the PM reminder", entry)
+	}
+}
+
+func TestSchedulerUpdate(t *testing.T) {
+	now := time.Date(2018, 8, 17, 8, 0, 0, 0, JST())
+	f := newSchedulerFixture(now, nil)
+	user := testUser("U1", "0900", "1800")
+	other := testUser("U2", "0830", "1730")
+	f.setUser(user)
+	f.setUser(other)
+	f.scheduler.Load([]*User{user, other})
+
+	f.setUser(testUser("U1", "1000", "1900"))
+	f.scheduler.Update("U1")
+	upcoming := map[string]time.Time{}
+	for _, entry := range f.scheduler.Upcoming() {
+		upcoming[entry.UserID+" "+entry.Kind] = entry.FireAt
+	}
+	want := map[string]time.Time{
+		"U1 am": time.Date(2018, 8, 17, 10, 0, 0, 0, JST()),
+		"U1 pm": time.Date(2018, 8, 17, 19, 0, 0, 0, JST()),
+		"U2 am": time.Date(2018, 8, 17, 8, 30, 0, 0, JST()),
+		"U2 pm": time.Date(2018, 8, 17, 17, 30, 0, 0, JST()),
+	}
+	if len(upcoming) != len(want) {
+		t.Fatalf("upcoming = %v, want %v", upcoming, want)
+	}
+	for key, fireAt := range want {
+		if !upcoming[key].Equal(fireAt) {
+			t.Errorf("%s is at %s, want %s", key, upcoming[key], fireAt)
+		}
+	}
+
+	// The reminders of a removed user are dropped.
+	f.removeUser("U2")
+	f.scheduler.Update("U2")
+	for _, entry := range f.scheduler.Upcoming() {
+		if entry.UserID == "U2" {
+			t.Errorf("reminder of the removed user is still scheduled: %+v", entry)
+		}
+	}
+
+	// The running scheduler picks up the new time.
+	defer f.run(t)()
+	entry := f.next(t, 3*time.Hour)
+	if entry.UserID != "U1" || !entry.FireAt.Equal(time.Date(2018, 8, 17, 10, 0, 0, 0, JST())) {
+		t.Errorf("delivered %+v, want the AM reminder of U1 at 10:00", entry)
+	}
+}
+
+func TestSchedulerRecordsFailures(t *testing.T) {
+	now := time.Date(2018, 8, 17, 8, 59, 0, 0, JST())
+	f := newSchedulerFixture(now, func(entry ReminderEntry) (bool, error) {
+		return false, fmt.Errorf("channel_not_found")
+	})
+	user := testUser("U1", "0900", "1800")
+	f.setUser(user)
+	f.scheduler.Load([]*User{user})
+	defer f.run(t)()
+
+	entry := f.next(t, time.Hour)
+	select {
+	case userID := <-f.errors:
+		if userID != "U1" {
+			t.Errorf("recorded the error of %s, want U1", userID)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("the error was not recorded")
+	}
+	if status := f.deliveries.Status(entry); status != deliveryFailed {
+		t.Errorf("status = %q, want %q", status, deliveryFailed)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// buttonSecret is the key to sign the values of the buttons. It is set from button_secret in config.toml.
+var buttonSecret []byte
+
+// signActions binds the buttons and the menus of the message to the user who it is sent to,
+// so that nobody else can punch with them, e.g. when the message is forwarded.
+func signActions(owner string, parameters slack.PostMessageParameters) slack.PostMessageParameters {
+	for i := range parameters.Attachments {
+		for j := range parameters.Attachments[i].Actions {
+			action := &parameters.Attachments[i].Actions[j]
+			if action.Type == "select" {
+				for k := range action.Options {
+					action.Options[k].Value = signValue(owner, action.Name, action.Options[k].Value)
+				}
+				continue
+			}
+			action.Value = signValue(owner, action.Name, action.Value)
+		}
+	}
+	return parameters
+}
+
+// signValue returns the value like "U0123ABCD|signature|value".
+func signValue(owner, name, value string) string {
+	return owner + "|" + valueSignature(owner, name, value) + "|" + value
+}
+
+func valueSignature(owner, name, value string) string {
+	mac := hmac.New(sha256.New, buttonSecret)
+	mac.Write([]byte(owner + "|" + name + "|" + value))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// openValue returns the owner and the original value of a signed value. ok is false if the signature is invalid.
+// A value which is not signed, e.g. of a message posted before the values were signed, has no owner.
+func openValue(name, signed string) (owner, value string, ok bool) {
+	parts := strings.SplitN(signed, "|", 3)
+	if len(parts) != 3 {
+		return "", signed, true
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(valueSignature(parts[0], name, parts[2]))) {
+		return "", "", false
+	}
+	return parts[0], parts[2], true
+}
+
+// verifyOwner replaces the signed values of the action with the original ones and returns the owner of the buttons.
+func verifyOwner(message *slack.AttachmentActionCallback) (string, bool) {
+	action := &message.Actions[0]
+	if len(action.SelectedOptions) == 0 {
+		owner, value, ok := openValue(action.Name, action.Value)
+		action.Value = value
+		return owner, ok
+	}
+
+	owner := ""
+	for i := range action.SelectedOptions {
+		optionOwner, value, ok := openValue(action.Name, action.SelectedOptions[i].Value)
+		if !ok || (i > 0 && optionOwner != owner) {
+			return "", false
+		}
+		owner = optionOwner
+		action.SelectedOptions[i].Value = value
+	}
+	return owner, true
+}
+
+// ownDirectMessage reports whether the action was taken in the DM channel between the user and the bot.
+func ownDirectMessage(message slack.AttachmentActionCallback) bool {
+	user, err := FindUser(message.User.ID)
+	return err == nil && user.SlackChannelID == message.Channel.ID
+}
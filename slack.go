@@ -1,11 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"io/ioutil"
-	"os"
 	"time"
 	"unicode/utf8"
 
@@ -18,6 +19,10 @@ const (
 	actionOut    = "out"
 	actionLeave  = "leave"
 	actionCancel = "cancel"
+	actionSnooze = "snooze"
+	actionUndo   = "undo"
+
+	actionCorrectIn = "correct_in"
 
 	callbackID = "punch"
 
@@ -34,24 +39,54 @@ const (
 		in
 		in now
 		in 0930
+		in 9:30
+		in yesterday 0930
 
 	Check Out:
 		out
 		out now
 		out 1810
+		out -15m
+		out 2018-08-17 1920
 
 	Off:
 		leave
 		off
 
+	Undo:
+		undo
+
 	Reminder:
 		reminder set 0900 1700
+		reminder set mon-thu 0900 1800
+		reminder skip wed
+		reminder reset
+		reminder show
+		reminder always on
+		reminder always off
+		reminder attime on
+		reminder attime off
 		reminder off
 
+	Time Zone:
+		timezone
+		timezone Asia/Taipei
+		timezone auto
+
+	Digest:
+		digest on
+		digest off
+
 	Report:
 		report
 		report -json
 		report -json -incomplete
+		report team [group]
+		report team [group] 2018-08
+
+	Audit:
+		audit
+		audit 2018-08-01 2018-08-31
 
 	Bulk Update:
 		update [
@@ -63,31 +98,59 @@ const (
 )
 
 type SlackListener struct {
-	client *slack.Client
-	botID  string
+	client     *slack.Client
+	botID      string
+	supervisor *Supervisor
 }
 
-func (s *SlackListener) ListenAndResponse() {
+func (s *SlackListener) ListenAndResponse(ctx context.Context) error {
 	rtm := s.client.NewRTM()
 	go rtm.ManageConnection()
+	defer rtm.Disconnect()
 
-	for msg := range rtm.IncomingEvents {
-		switch ev := msg.Data.(type) {
-		case *slack.MessageEvent:
-			if err := s.handleMessageEvent(ev); err != nil {
-				s.respond(ev.Channel, fmt.Sprintf(":warning: %s", err))
-				sugar.Errorf("Failed to handle message: %s", err)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-rtm.IncomingEvents:
+			if !ok {
+				return fmt.Errorf("rtm connection was closed")
+			}
+			switch ev := msg.Data.(type) {
+			case *slack.MessageEvent:
+				if err := s.handleMessage(ev); err != nil {
+					s.respond(ev.Channel, fmt.Sprintf(":warning: %s", err))
+					sugar.Errorf("Failed to handle message: %s", err)
+					RecordError(ev.Msg.User, err)
+				}
+			case *slack.InvalidAuthEvent:
+				return fmt.Errorf("invalid bot token")
 			}
 		}
 	}
 }
 
+// handleMessage isolates a panic in a message handler so that it doesn't stop listening to the other messages.
+func (s *SlackListener) handleMessage(ev *slack.MessageEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return s.handleMessageEvent(ev)
+}
+
 func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 	if ev.Msg.SubType == "bot_message" {
 		return nil
 	}
 
 	isDirectMessageChannel := strings.HasPrefix(ev.Msg.Channel, "D")
+	if isDirectMessageChannel {
+		if err := authorize(ev.Msg.User, ev.Msg.Text); err != nil {
+			return s.respond(ev.Channel, fmt.Sprintf(":warning: %s.", err))
+		}
+	}
 	if isDirectMessageChannel && ev.Msg.Text == "auth" {
 		authURL := AuthCodeURL()
 		return s.respond(ev.Channel, fmt.Sprintf("Please open the following URL in your browser:\n%s", authURL))
@@ -128,6 +191,7 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 				EmployeeID:     employeeID,
 			}
 		}
+		user.TimeZone = s.slackTimeZone(ev.Msg.User)
 
 		err := user.Save()
 		if err != nil {
@@ -141,7 +205,7 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 		}
 	}
 	if isDirectMessageChannel && (ev.Msg.Text == "unregister" || ev.Msg.Text == "remove") {
-		err := os.Remove(fmt.Sprintf("users/%s", ev.Msg.User))
+		err := RemoveUser(ev.Msg.User)
 		if err != nil {
 			s.respond(ev.Channel, fmt.Sprintf(":warning: Failed to remove '%s'.", ev.User))
 			return err
@@ -149,7 +213,10 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 
 		return s.respond(ev.Channel, fmt.Sprintf(":ok: '%s' was removed successfully.", ev.User))
 	}
-	if isDirectMessageChannel && (strings.HasPrefix(ev.Msg.Text, "admin register") || strings.HasPrefix(ev.Msg.Text, "admin add")) {
+	if isDirectMessageChannel && isUserAdminCommand(ev.Msg.Text) {
+		return s.handleUserAdminCommand(ev.Msg.User, ev.Channel, ev.Msg.Text)
+	}
+	if isDirectMessageChannel && (isCommand(ev.Msg.Text, "admin register") || isCommand(ev.Msg.Text, "admin add")) {
 		fields := strings.Fields(ev.Msg.Text)
 		if len(fields) != 3 {
 			return s.respond(ev.Channel, ":warning: Invalid parameters.")
@@ -176,19 +243,11 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 		if err != nil {
 			return err
 		}
+		Audit(AuditEntry{Actor: ev.Msg.User, Action: "admin add", Source: sourceDM})
 
 		return s.respond(ev.Channel, ":ok: Saved the admin access token successfully.")
 	}
 	if isDirectMessageChannel && ev.Msg.Text == "admin stat" {
-		admin, err := FindUser("admin")
-		if err != nil {
-			return err
-		}
-
-		if ev.Channel != admin.SlackChannelID {
-			return s.respond(ev.Channel, ":warning: `stat` command requires admin privileges.")
-		}
-
 		fileInfo, err := ioutil.ReadDir("users")
 		if err != nil {
 			return err
@@ -200,7 +259,7 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 
 		for _, file := range fileInfo {
 			userID := file.Name()
-			if userID == "admin" {
+			if userID == "admin" || strings.HasPrefix(userID, ".") {
 				continue
 			}
 			user, err := FindUser(userID)
@@ -217,44 +276,95 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 			stats = append(stats, fmt.Sprintf("%-11s  %-8s  %-16s", user.EmployeeID, reminder, user.LastUsed.Format("2006/01/02 15:04")))
 		}
 
+		stats = append(stats, "")
+		stats = append(stats, "Worker             State       Restarts  Last Error")
+		stats = append(stats, "-----------------  ----------  --------  ----------------")
+		for _, status := range s.supervisor.Status() {
+			lastError := ""
+			if status.LastError != "" {
+				lastError = fmt.Sprintf("%s %s", status.LastErrorAt.In(JST()).Format("2006/01/02 15:04"), status.LastError)
+			}
+			stats = append(stats, fmt.Sprintf("%-17s  %-10s  %8d  %s", status.Name, status.State, status.Restarts, lastError))
+		}
+
 		return s.respond(ev.Channel, fmt.Sprintf("```\n%s\n```", strings.Join(stats, "\n")))
 	}
+	if isDirectMessageChannel && isCommand(ev.Msg.Text, "admin deliveries") {
+		fields := strings.Fields(ev.Msg.Text)
+		if len(fields) != 3 && len(fields) != 4 {
+			return s.respond(ev.Channel, ":warning: Invalid parameters.")
+		}
+		userID, ok := parseMention(fields[2])
+		if !ok {
+			return s.respond(ev.Channel, ":warning: Invalid user.")
+		}
+		days := 7
+		if len(fields) == 4 {
+			var err error
+			days, err = strconv.Atoi(fields[3])
+			if err != nil || days <= 0 {
+				return s.respond(ev.Channel, ":warning: Invalid parameters.")
+			}
+		}
+
+		since := now().AddDate(0, 0, -days)
+		results := []string{}
+		results = append(results, "Date        Kind    Scheduled  Handled  Status   Error")
+		results = append(results, "----------  ------  ---------  -------  -------  ----------------")
+		for _, delivery := range FindDeliveryLog(userID).Deliveries {
+			if delivery.FireAt.Before(since) {
+				continue
+			}
+			fireAt := delivery.FireAt.In(JST())
+			results = append(results, fmt.Sprintf("%s  %-6s  %-9s  %-7s  %-7s  %s", fireAt.Format("2006/01/02"), delivery.Kind, fireAt.Format("15:04"), delivery.HandledAt.In(JST()).Format("15:04"), delivery.Status, delivery.Error))
+		}
+
+		return s.respond(ev.Channel, fmt.Sprintf("```\n%s\n```", strings.Join(results, "\n")))
+	}
+	if isDirectMessageChannel && (ev.Msg.Text == "admin roles" || strings.HasPrefix(ev.Msg.Text, "admin role ")) {
+		return s.handleRoleCommand(ev.Msg.User, ev.Channel, strings.Fields(ev.Msg.Text))
+	}
+	if isDirectMessageChannel && (ev.Msg.Text == "admin groups" || strings.HasPrefix(ev.Msg.Text, "admin group ")) {
+		return s.handleGroupCommand(ev.Msg.User, ev.Channel, strings.Fields(ev.Msg.Text))
+	}
 	if isDirectMessageChannel && (ev.Msg.Text == "in" || ev.Msg.Text == "out") {
-		if _, _, err := s.client.PostMessage(ev.Channel, "", checkInOptions()); err != nil {
+		user, err := FindUser(ev.Msg.User)
+		if err != nil {
+			return s.respond(ev.Channel, ":warning: You are not registered yet. Send `add [emp_id]` to me first.")
+		}
+		record, err := TodayRecord(ev.Msg.User)
+		if err != nil {
+			sugar.Warnf("Failed to get today's record [%s]: %s", ev.Msg.User, err)
+			record = nil
+		}
+		if _, _, err := s.client.PostMessage(ev.Channel, "", signActions(ev.Msg.User, checkInOptions(user, record))); err != nil {
 			return fmt.Errorf("failed to post message: %s", err)
 		}
 		return nil
 	}
-	if isDirectMessageChannel && (strings.HasPrefix(ev.Msg.Text, "in") || strings.HasPrefix(ev.Msg.Text, "out")) {
-		fields := strings.Fields(ev.Msg.Text)
-		if len(fields) != 2 {
-			return s.respond(ev.Channel, ":warning: Invalid parameters.")
+	if isDirectMessageChannel && (strings.HasPrefix(ev.Msg.Text, "in ") || strings.HasPrefix(ev.Msg.Text, "out ")) {
+		fields := strings.SplitN(ev.Msg.Text, " ", 2)
+		now := slackTime(ev.Msg.Timestamp).In(userLocation(ev.Msg.User))
+		clock, err := ParseTimeExpression(fields[1], now)
+		if err != nil {
+			return s.respond(ev.Channel, fmt.Sprintf(":warning: %s. Try `%s 0930`, `%s 9:30`, `%s -15m` or `%s yesterday 1920`.", err, fields[0], fields[0], fields[0], fields[0]))
 		}
 
-		var clock time.Time
-		timeParam := fields[1]
-		if timeParam == "now" {
-			clock = time.Now()
-		} else {
-			t, err := time.Parse("1504", timeParam)
-			if err != nil {
-				return err
-			}
-			now := time.Now()
-			tokyoTime := time.FixedZone("Asia/Tokyo", 9*60*60)
-			clock = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, tokyoTime)
+		if reason := unusualPunchTime(fields[0], clock, now); reason != "" {
+			_, _, err := s.client.PostMessage(ev.Channel, fmt.Sprintf(":thinking_face: *%s* is %s. Are you sure?", clock.Format("2006/01/02 15:04"), reason), signActions(ev.Msg.User, confirmPunchOptions(fields[0], clock)))
+			return err
 		}
 
 		if fields[0] == "in" {
 			responseText := fmt.Sprintf(":ok: You have punched in at *%s*.", clock.Format("2006/01/02 15:04"))
-			err := PunchInAt(ev.Msg.User, clock)
+			err := PunchInAt(ev.Msg.User, clock, sourceDM)
 			if err != nil {
 				return err
 			}
 			return s.respond(ev.Channel, responseText)
 		} else {
 			responseText := fmt.Sprintf(":ok: You have punched out at *%s*.", clock.Format("2006/01/02 15:04"))
-			err := PunchOutAt(ev.Msg.User, clock)
+			err := PunchOutAt(ev.Msg.User, clock, sourceDM)
 			if err != nil {
 				return err
 			}
@@ -263,12 +373,28 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 	}
 	if isDirectMessageChannel && (ev.Msg.Text == "leave" || ev.Msg.Text == "off") {
 		responseText := ":ok: You are off today. Enjoy :tada:"
-		err := PunchLeave(ev.Msg.User)
+		err := PunchLeave(ev.Msg.User, sourceDM)
 		if err != nil {
 			return err
 		}
 		return s.respond(ev.Channel, responseText)
 	}
+	if isDirectMessageChannel && (ev.Msg.Text == "audit" || strings.HasPrefix(ev.Msg.Text, "audit ")) {
+		return s.handleAuditCommand(ev.Msg.User, ev.Channel, strings.Fields(ev.Msg.Text))
+	}
+	if isDirectMessageChannel && (ev.Msg.Text == "timezone" || strings.HasPrefix(ev.Msg.Text, "timezone ")) {
+		return s.handleTimeZoneCommand(ev.Msg.User, ev.Channel, strings.Fields(ev.Msg.Text))
+	}
+	if isDirectMessageChannel && ev.Msg.Text == "undo" {
+		change, err := Undo(ev.Msg.User, "", sourceDM, nil)
+		if err != nil {
+			return err
+		}
+		if change == nil {
+			return s.respond(ev.Channel, fmt.Sprintf(":warning: There is no change to undo in the last %d minutes.", int(undoWindow.Minutes())))
+		}
+		return s.respond(ev.Channel, fmt.Sprintf(":ok: Undid the %s on *%s*.", change.Action, change.Dates()))
+	}
 	if isDirectMessageChannel && ev.Msg.Text == "timesheet" {
 		record, err := Timesheet(ev.Msg.User)
 		if err != nil {
@@ -280,6 +406,31 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 		}
 		return s.respond(ev.Channel, fmt.Sprintf("```\n%s\n```", string(byte)))
 	}
+	if isDirectMessageChannel && isCommand(ev.Msg.Text, "report team") {
+		fields := strings.Fields(ev.Msg.Text)
+		if len(fields) != 3 && len(fields) != 4 {
+			return s.respond(ev.Channel, ":warning: Invalid parameters.")
+		}
+
+		group, err := FindGroup(fields[2])
+		if err != nil {
+			return err
+		}
+		if !group.IsManager(ev.User) && RoleOf(ev.User) < RoleAdmin {
+			return s.respond(ev.Channel, ":warning: `report team` command requires the manager of the group.")
+		}
+
+		month := now()
+		if len(fields) == 4 {
+			month, err = time.ParseInLocation("2006-01", strings.Replace(fields[3], "/", "-", 1), JST())
+			if err != nil || month.After(now()) {
+				return s.respond(ev.Channel, ":warning: Invalid month.")
+			}
+		}
+
+		go s.sendTeamReport(ev.Channel, group, month)
+		return nil
+	}
 	if isDirectMessageChannel && strings.HasPrefix(ev.Msg.Text, "report") {
 		go func() {
 			fields := strings.Fields(ev.Msg.Text)
@@ -319,6 +470,7 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 
 			s.respond(ev.Channel, ":hourglass: Creating timesheet report ...")
 
+			location := userLocation(ev.Msg.User)
 			records, err := Report(ev.Msg.User)
 			if err != nil {
 				s.respond(ev.Channel, fmt.Sprintf(":warning: %s", err))
@@ -360,14 +512,14 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 						in = "     "
 					} else {
 						inTime, _ := time.Parse(time.RFC3339, in.(string))
-						in = inTime.Format("15:04")
+						in = inTime.In(location).Format("15:04")
 					}
 					out := record["out"]
 					if out == nil {
 						out = "     "
 					} else {
 						outTime, _ := time.Parse(time.RFC3339, out.(string))
-						out = outTime.Format("15:04")
+						out = outTime.In(location).Format("15:04")
 					}
 					var off string
 					if record["off"].(bool) {
@@ -393,7 +545,7 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 			}
 
 			s.respond(ev.Channel, ":hourglass: Start bulk update ...")
-			err := BulkUpdate(ev.User, records)
+			err := BulkUpdate(ev.User, records, sourceDM)
 			if err != nil {
 				s.respond(ev.Channel, fmt.Sprintf(":warning: %s", err))
 				return
@@ -405,13 +557,18 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 	}
 	if isDirectMessageChannel && strings.HasPrefix(ev.Msg.Text, "reminder set") {
 		fields := strings.Fields(ev.Msg.Text)
-		if len(fields) != 4 {
+		if len(fields) != 4 && len(fields) != 5 {
 			return s.respond(ev.Channel, ":warning: Invalid parameters.")
 		}
 
-		user, err := FindUser(ev.User)
-		if err != nil {
-			return err
+		var weekdays []time.Weekday
+		var err error
+		if len(fields) == 5 {
+			weekdays, err = ParseWeekdays(fields[2])
+			if err != nil {
+				return err
+			}
+			fields = append(fields[:2], fields[3:]...)
 		}
 
 		am, err := time.Parse("1504", fields[2])
@@ -423,25 +580,138 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 			return err
 		}
 
-		user.Reminder.Enabled = true
-		user.Reminder.AM = am
-		user.Reminder.PM = pm
-		err = user.Save()
+		err = updateReminder(ev.User, func(reminder *Reminder) {
+			reminder.Enabled = true
+			if weekdays == nil {
+				reminder.AM = am
+				reminder.PM = pm
+				return
+			}
+			if reminder.Days == nil {
+				reminder.Days = map[string]DayReminder{}
+			}
+			for _, weekday := range weekdays {
+				reminder.Days[weekdayNames[weekday]] = DayReminder{AM: am, PM: pm}
+			}
+		})
 		if err != nil {
 			return err
 		}
 
 		return s.respond(ev.Channel, fmt.Sprintf(":ok: The reminders have been set to *%s*/*%s*", am.Format("15:04"), pm.Format("15:04")))
 	}
-	if isDirectMessageChannel && ev.Msg.Text == "reminder off" {
-		responseText := ":ok: The reminders have been turned off."
+	if isDirectMessageChannel && strings.HasPrefix(ev.Msg.Text, "reminder skip") {
+		fields := strings.Fields(ev.Msg.Text)
+		if len(fields) != 3 {
+			return s.respond(ev.Channel, ":warning: Invalid parameters.")
+		}
+
+		weekdays, err := ParseWeekdays(fields[2])
+		if err != nil {
+			return err
+		}
+
+		err = updateReminder(ev.User, func(reminder *Reminder) {
+			if reminder.Days == nil {
+				reminder.Days = map[string]DayReminder{}
+			}
+			for _, weekday := range weekdays {
+				reminder.Days[weekdayNames[weekday]] = DayReminder{Skip: true}
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		return s.respond(ev.Channel, fmt.Sprintf(":ok: The reminders will be skipped on *%s*.", fields[2]))
+	}
+	if isDirectMessageChannel && strings.HasPrefix(ev.Msg.Text, "reminder reset") {
+		fields := strings.Fields(ev.Msg.Text)
+		if len(fields) != 2 && len(fields) != 3 {
+			return s.respond(ev.Channel, ":warning: Invalid parameters.")
+		}
+
+		var weekdays []time.Weekday
+		if len(fields) == 3 {
+			var err error
+			weekdays, err = ParseWeekdays(fields[2])
+			if err != nil {
+				return err
+			}
+		}
+
+		err := updateReminder(ev.User, func(reminder *Reminder) {
+			if weekdays == nil {
+				reminder.Days = nil
+				return
+			}
+			for _, weekday := range weekdays {
+				delete(reminder.Days, weekdayNames[weekday])
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		return s.respond(ev.Channel, ":ok: The reminders have been reset to the default schedule.")
+	}
+	if isDirectMessageChannel && ev.Msg.Text == "reminder show" {
 		user, err := FindUser(ev.User)
 		if err != nil {
 			return err
 		}
 
-		user.Reminder.Enabled = false
-		err = user.Save()
+		status := "OFF"
+		if user.Reminder.Enabled {
+			status = "ON"
+		}
+		lines := []string{fmt.Sprintf("Reminder: %s", status), ""}
+		lines = append(lines, reminderSchedule(user.Reminder)...)
+
+		return s.respond(ev.Channel, fmt.Sprintf("```\n%s\n```", strings.Join(lines, "\n")))
+	}
+	if isDirectMessageChannel && (ev.Msg.Text == "reminder always on" || ev.Msg.Text == "reminder always off") {
+		alwaysOn := ev.Msg.Text == "reminder always on"
+		err := updateReminder(ev.User, func(reminder *Reminder) { reminder.AlwaysOn = alwaysOn })
+		if err != nil {
+			return err
+		}
+
+		if alwaysOn {
+			return s.respond(ev.Channel, ":ok: The reminders will be sent even if you have already punched.")
+		}
+		return s.respond(ev.Channel, ":ok: The reminders will be skipped if you have already punched.")
+	}
+	if isDirectMessageChannel && (ev.Msg.Text == "reminder attime on" || ev.Msg.Text == "reminder attime off") {
+		atTime := ev.Msg.Text == "reminder attime on"
+		err := updateReminder(ev.User, func(reminder *Reminder) { reminder.AtTime = atTime })
+		if err != nil {
+			return err
+		}
+
+		if atTime {
+			return s.respond(ev.Channel, ":ok: The reminders will have a button to punch at the time of the reminder.")
+		}
+		return s.respond(ev.Channel, ":ok: The reminders will have only the buttons to punch now.")
+	}
+	if isDirectMessageChannel && (ev.Msg.Text == "digest on" || ev.Msg.Text == "digest off") {
+		optOut := ev.Msg.Text == "digest off"
+		_, err := UpdateUser(ev.User, func(user *User) error {
+			user.DigestOptOut = optOut
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if optOut {
+			return s.respond(ev.Channel, ":ok: You will not be listed in the managers' daily digest.")
+		}
+		return s.respond(ev.Channel, ":ok: You will be listed in the managers' daily digest.")
+	}
+	if isDirectMessageChannel && ev.Msg.Text == "reminder off" {
+		responseText := ":ok: The reminders have been turned off."
+		err := updateReminder(ev.User, func(reminder *Reminder) { reminder.Enabled = false })
 		if err != nil {
 			return err
 		}
@@ -458,86 +728,234 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 	return nil
 }
 
+// reminderSchedule returns the reminder times of each weekday starting from Monday.
+func reminderSchedule(reminder Reminder) []string {
+	lines := []string{}
+	for i := 1; i <= 7; i++ {
+		weekday := time.Weekday(i % 7)
+		name := strings.ToUpper(weekdayNames[weekday][:1]) + weekdayNames[weekday][1:]
+		am, pm, ok := reminder.On(weekday)
+		if !ok {
+			lines = append(lines, fmt.Sprintf("%s  (skip)", name))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s  %s", name, am.Format("15:04"), pm.Format("15:04")))
+	}
+	return lines
+}
+
+// parseMention extracts the user ID from a mention like <@U012AB3CD> or <@U012AB3CD|name>.
+func parseMention(text string) (string, bool) {
+	if !strings.HasPrefix(text, "<@") || !strings.HasSuffix(text, ">") {
+		return "", false
+	}
+	userID := strings.SplitN(text[2:len(text)-1], "|", 2)[0]
+	return userID, userID != ""
+}
+
 func (s *SlackListener) respond(channel string, text string) error {
 	_, _, err := s.client.PostMessage(channel, text, slack.NewPostMessageParameters())
 	return err
 }
 
-func checkInOptions() slack.PostMessageParameters {
+// checkInOptions shows today's record and the buttons to punch. The buttons which would overwrite
+// what is already recorded are replaced, e.g. "Punch in" with a menu to correct the clock-in time.
+// record is nil if today's record couldn't be fetched.
+func checkInOptions(user *User, record map[string]interface{}) slack.PostMessageParameters {
+	now := user.Now()
+	text := now.Format("2006/01/02 (Mon) 15:04")
+	if record != nil {
+		summary := record
+		if record["clock_out_at"] != nil && !alreadyPunched(user.SlackUserID, record, false) {
+			// The clock-out is the placeholder written with the clock-in.
+			summary = map[string]interface{}{}
+			for key, value := range record {
+				summary[key] = value
+			}
+			summary["clock_out_at"] = nil
+		}
+		text += "\n" + todaySummary(summary, user.Location())
+	} else {
+		text += "\n:warning: Failed to get today's record. It may not show what is already recorded."
+	}
+
+	isAbsence, _ := record["is_absence"].(bool)
+	actions := []slack.AttachmentAction{}
+	if clockIn, err := time.Parse(time.RFC3339, fmt.Sprint(record["clock_in_at"])); err == nil && !isAbsence {
+		actions = append(actions, correctInAction(clockIn.In(user.Location()), now))
+	} else {
+		actions = append(actions, slack.AttachmentAction{
+			Name:  actionIn,
+			Text:  "Punch in",
+			Type:  "button",
+			Style: "primary",
+		})
+	}
+	actions = append(actions, slack.AttachmentAction{
+		Name:  actionOut,
+		Text:  "Punch out",
+		Type:  "button",
+		Style: "primary",
+	})
+	if !isAbsence {
+		actions = append(actions, slack.AttachmentAction{
+			Name:  actionLeave,
+			Text:  "Leave",
+			Type:  "button",
+			Style: "danger",
+		})
+	}
+	actions = append(actions, slack.AttachmentAction{
+		Name: actionCancel,
+		Text: "Cancel",
+		Type: "button",
+	})
+
 	attachment := slack.Attachment{
-		Text:       time.Now().Format("2006/01/02 15:04"),
+		Text:       text,
+		CallbackID: callbackID,
+		Actions:    actions,
+	}
+	snooze := slack.Attachment{
+		Text:       "Remind me later",
 		CallbackID: callbackID,
 		Actions: []slack.AttachmentAction{
 			{
-				Name:  actionIn,
-				Text:  "Punch in",
+				Name:  actionSnooze,
+				Text:  "15 min",
 				Type:  "button",
-				Style: "primary",
+				Value: "15",
 			},
 			{
-				Name:  actionOut,
-				Text:  "Punch out",
+				Name:  actionSnooze,
+				Text:  "30 min",
 				Type:  "button",
-				Style: "primary",
+				Value: "30",
 			},
 			{
-				Name:  actionLeave,
-				Text:  "Leave",
+				Name:  actionSnooze,
+				Text:  "1 hour",
 				Type:  "button",
-				Style: "danger",
-			},
-			{
-				Name: actionCancel,
-				Text: "Cancel",
-				Type: "button",
+				Value: "60",
 			},
 		},
 	}
 	parameters := slack.PostMessageParameters{
 		Attachments: []slack.Attachment{
 			attachment,
+			snooze,
 		},
 	}
 	return parameters
 }
 
-func (s *SlackListener) sendReminderMessage() error {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ticker.C:
-			location := time.FixedZone("Asia/Tokyo", 9*60*60)
-			now := time.Now().In(location)
+// confirmPunchOptions asks to confirm a punch at an unusual time. The time is passed as the value of the button.
+func confirmPunchOptions(command string, clock time.Time) slack.PostMessageParameters {
+	action := slack.AttachmentAction{
+		Name:  actionIn,
+		Text:  fmt.Sprintf("Punch in at %s", clock.Format("01/02 15:04")),
+		Type:  "button",
+		Style: "primary",
+		Value: clock.Format(time.RFC3339),
+	}
+	if command == "out" {
+		action.Name = actionOut
+		action.Text = fmt.Sprintf("Punch out at %s", clock.Format("01/02 15:04"))
+	}
+	return slack.PostMessageParameters{
+		Attachments: []slack.Attachment{
+			{
+				CallbackID: callbackID,
+				Actions: []slack.AttachmentAction{
+					action,
+					{
+						Name: actionCancel,
+						Text: "Cancel",
+						Type: "button",
+					},
+				},
+			},
+		},
+	}
+}
 
-			fileInfo, err := ioutil.ReadDir("users")
-			if err != nil {
-				return err
-			}
+// correctInAction is a menu of the times around the recorded clock-in up to now.
+func correctInAction(clockIn, now time.Time) slack.AttachmentAction {
+	options := []slack.AttachmentActionOption{}
+	start := clockIn.Truncate(15 * time.Minute).Add(-3 * time.Hour)
+	for t := start; t.Before(clockIn.Add(3*time.Hour)) && !t.After(now); t = t.Add(15 * time.Minute) {
+		options = append(options, slack.AttachmentActionOption{
+			Text:  t.Format("15:04"),
+			Value: t.Format(time.RFC3339),
+		})
+	}
+	return slack.AttachmentAction{
+		Name:    actionCorrectIn,
+		Text:    fmt.Sprintf("Correct in time (%s)", clockIn.Format("15:04")),
+		Type:    "select",
+		Options: options,
+	}
+}
 
-			for _, file := range fileInfo {
-				userID := file.Name()
-				if userID == "admin" {
-					continue
-				}
-				user, err := FindUser(userID)
-				if err != nil {
-					continue
-				}
-				if !user.Reminder.Enabled {
-					continue
-				}
-				reminder := user.Reminder
-				if (now.Hour() != reminder.AM.Hour() || now.Minute() != reminder.AM.Minute()) && (now.Hour() != reminder.PM.Hour() || now.Minute() != reminder.PM.Minute()) {
-					continue
-				}
-				if !IsNormalDay(userID) {
-					continue
-				}
-				if _, _, err := s.client.PostMessage(user.SlackChannelID, "", checkInOptions()); err != nil {
-					return fmt.Errorf("failed to post message: %s", err)
-				}
-			}
+func (s *SlackListener) deliverReminder(entry ReminderEntry) (bool, error) {
+	user, err := FindUser(entry.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	record, err := TodayRecord(entry.UserID)
+	if entry.Kind == reminderSnooze {
+		if err := updateReminder(entry.UserID, func(reminder *Reminder) { reminder.Snooze = time.Time{} }); err != nil {
+			return false, err
+		}
+		if err != nil {
+			sugar.Warnf("Failed to get today's record [%s]: %s", entry.UserID, err)
+			record = nil
+		}
+	} else {
+		if err != nil {
+			return false, err
+		}
+		if record["day_pattern"] != "normal_day" {
+			return false, nil
+		}
+		if !user.Reminder.AlwaysOn && alreadyPunched(entry.UserID, record, entry.Kind == reminderAM) {
+			return false, nil
+		}
+	}
+
+	text := ""
+	if entry.Late {
+		text = fmt.Sprintf("You missed the *%s* reminder while I was away.", entry.FireAt.Format("15:04"))
+	}
+	parameters := checkInOptions(user, record)
+	if user.Reminder.AtTime && entry.Kind != reminderSnooze {
+		parameters.Attachments[0].Actions = withReminderTimeAction(parameters.Attachments[0].Actions, entry)
+	}
+	if _, _, err := s.client.PostMessage(user.SlackChannelID, text, signActions(user.SlackUserID, parameters)); err != nil {
+		return false, fmt.Errorf("failed to post message: %s", err)
+	}
+	return true, nil
+}
+
+// withReminderTimeAction adds the button to punch at the scheduled time of the reminder next to "Punch in" or "Punch out".
+func withReminderTimeAction(actions []slack.AttachmentAction, entry ReminderEntry) []slack.AttachmentAction {
+	name, text := actionOut, "Out at %s"
+	if entry.Kind == reminderAM {
+		name, text = actionIn, "In at %s"
+	}
+
+	result := []slack.AttachmentAction{}
+	for _, action := range actions {
+		result = append(result, action)
+		if action.Name == name {
+			result = append(result, slack.AttachmentAction{
+				Name:  name,
+				Text:  fmt.Sprintf(text, entry.FireAt.Format("15:04")),
+				Type:  "button",
+				Value: entry.FireAt.Format(time.RFC3339),
+			})
 		}
 	}
+	return result
 }
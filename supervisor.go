@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	workerRunning    = "running"
+	workerRestarting = "restarting"
+	workerStopped    = "stopped"
+
+	workerMinBackoff = 1 * time.Second
+	workerMaxBackoff = 5 * time.Minute
+	// A worker which kept running longer than this is considered healthy again and its backoff is reset.
+	workerStableAfter = 10 * time.Minute
+)
+
+type WorkerStatus struct {
+	Name        string    `json:"name"`
+	State       string    `json:"state"`
+	StartedAt   time.Time `json:"started_at"`
+	Restarts    int       `json:"restarts"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitempty"`
+}
+
+// Supervisor runs background workers and restarts them with backoff when they return an error or panic.
+type Supervisor struct {
+	mutex   sync.Mutex
+	workers map[string]*WorkerStatus
+}
+
+func NewSupervisor() *Supervisor {
+	return &Supervisor{
+		workers: map[string]*WorkerStatus{},
+	}
+}
+
+func (s *Supervisor) Go(ctx context.Context, name string, run func(ctx context.Context) error) {
+	// A worker restarted with the same name replaces the status, e.g. after the leadership moved back.
+	worker := &WorkerStatus{Name: name}
+	s.mutex.Lock()
+	s.workers[name] = worker
+	s.mutex.Unlock()
+
+	go func() {
+		backoff := workerMinBackoff
+		for {
+			startedAt := time.Now()
+			s.update(worker, func(status *WorkerStatus) {
+				status.State = workerRunning
+				status.StartedAt = startedAt
+			})
+
+			err := runWorker(ctx, run)
+			if ctx.Err() != nil {
+				s.update(worker, func(status *WorkerStatus) { status.State = workerStopped })
+				return
+			}
+			if err == nil {
+				err = fmt.Errorf("worker exited unexpectedly")
+			}
+			sugar.Errorf("Worker '%s' failed: %s", name, err)
+
+			if time.Since(startedAt) > workerStableAfter {
+				backoff = workerMinBackoff
+			}
+			s.update(worker, func(status *WorkerStatus) {
+				status.State = workerRestarting
+				status.Restarts++
+				status.LastError = err.Error()
+				status.LastErrorAt = time.Now()
+			})
+
+			select {
+			case <-ctx.Done():
+				s.update(worker, func(status *WorkerStatus) { status.State = workerStopped })
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > workerMaxBackoff {
+				backoff = workerMaxBackoff
+			}
+		}
+	}()
+}
+
+func (s *Supervisor) Status() []WorkerStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	statuses := []WorkerStatus{}
+	for _, status := range s.workers {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// statusHandler serves the status of the workers. The errors may contain the data of the users,
+// so the request must have the verification token like "Authorization: Bearer <token>" or "?token=<token>".
+type statusHandler struct {
+	supervisor        *Supervisor
+	verificationToken string
+}
+
+func (h statusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if h.verificationToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.verificationToken)) != 1 {
+		sugar.Warnf("Rejected a status request without the valid token from %s", r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.supervisor.Status())
+}
+
+func (s *Supervisor) update(worker *WorkerStatus, update func(status *WorkerStatus)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	update(worker)
+}
+
+func runWorker(ctx context.Context, run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run(ctx)
+}
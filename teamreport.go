@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// A day longer than this counts as overtime.
+const regularWorkingHours = 8 * time.Hour
+
+type memberSummary struct {
+	Name           string
+	DaysWorked     int
+	Total          time.Duration
+	Overtime       time.Duration
+	IncompleteDays int
+	Absences       int
+	Error          error
+}
+
+// IsManager reports whether the user manages the group.
+func (g *Group) IsManager(userID string) bool {
+	return containsString(g.Managers, userID)
+}
+
+// sendTeamReport aggregates the records of all members of the group and posts the result as a file.
+// It may take long because the records are fetched within the API rate limit.
+func (s *SlackListener) sendTeamReport(channel string, group *Group, month time.Time) {
+	s.respond(channel, fmt.Sprintf(":hourglass: Creating the report of '%s' for %s. I will post it when it's done ...", group.Name, month.Format("2006/01")))
+
+	users, err := AllUsers()
+	if err != nil {
+		sugar.Errorf("Failed to load users for the team report: %s", err)
+		s.respond(channel, fmt.Sprintf(":warning: Failed to create the report of '%s': %s", group.Name, err))
+		return
+	}
+	registered := map[string]*User{}
+	for _, user := range users {
+		registered[user.SlackUserID] = user
+	}
+
+	summaries := []memberSummary{}
+	for _, userID := range group.MemberIDs(registered) {
+		summary := memberSummary{Name: s.displayName(userID)}
+		records, err := BulkMonthRecords(userID, month)
+		if err != nil {
+			sugar.Errorf("Failed to get the records for the team report [%s]: %s", userID, err)
+			summary.Error = err
+			summaries = append(summaries, summary)
+			continue
+		}
+
+		today := now().Format("2006-01-02")
+		for _, record := range records {
+			if record["day_pattern"] != "normal_day" {
+				continue
+			}
+			if isAbsence, _ := record["is_absence"].(bool); isAbsence {
+				summary.Absences++
+				continue
+			}
+			if duration := workDuration(record); duration > 0 {
+				summary.DaysWorked++
+				summary.Total += duration
+				if duration > regularWorkingHours {
+					summary.Overtime += duration - regularWorkingHours
+				}
+			}
+			if record["date"] != today && isIncompleteRecord(record) {
+				summary.IncompleteDays++
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	lines := []string{}
+	lines = append(lines, fmt.Sprintf("%-20s  %4s  %7s  %8s  %10s  %8s", "Member", "Days", "Total", "Overtime", "Incomplete", "Absences"))
+	lines = append(lines, fmt.Sprintf("%-20s  %4s  %7s  %8s  %10s  %8s", strings.Repeat("-", 20), "----", "-------", "--------", "----------", "--------"))
+	for _, summary := range summaries {
+		if summary.Error != nil {
+			lines = append(lines, fmt.Sprintf("%-20s  error: %s", summary.Name, summary.Error))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%-20s  %4d  %7s  %8s  %10d  %8d", summary.Name, summary.DaysWorked, formatDuration(summary.Total), formatDuration(summary.Overtime), summary.IncompleteDays, summary.Absences))
+	}
+
+	_, err = s.client.UploadFile(slack.FileUploadParameters{
+		Content:  strings.Join(lines, "\n"),
+		Filetype: "text",
+		Filename: fmt.Sprintf("%s-%s.txt", group.Name, month.Format("2006-01")),
+		Title:    fmt.Sprintf("Attendance report of %s for %s", group.Name, month.Format("2006/01")),
+		Channels: []string{channel},
+	})
+	if err != nil {
+		s.respond(channel, fmt.Sprintf(":warning: Failed to post the report: %s", err))
+		sugar.Errorf("Failed to post the team report: %s", err)
+	}
+}
+
+func (s *SlackListener) displayName(userID string) string {
+	user, err := s.client.GetUserInfo(userID)
+	if err != nil {
+		return userID
+	}
+	if user.Profile.DisplayName != "" {
+		return user.Profile.DisplayName
+	}
+	if user.RealName != "" {
+		return user.RealName
+	}
+	return user.Name
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	clockPattern         = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+	compactClockPattern  = regexp.MustCompile(`^(\d{1,2})(\d{2})$`)
+	japaneseClockPattern = regexp.MustCompile(`^(\d{1,2})時(半|(\d{1,2})分)?$`)
+	meridiemClockPattern = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)$`)
+	shortDatePattern     = regexp.MustCompile(`^(\d{1,2})[/-](\d{1,2})$`)
+)
+
+// ParseTimeExpression parses the time given to the in/out commands.
+// It accepts "now", a relative time like "-15m" or "+1h30m", or a time like "0930", "9:30", "18時半" or "6pm"
+// optionally preceded by a date like "yesterday", "2018-08-17" or "8/17".
+func ParseTimeExpression(expression string, now time.Time) (time.Time, error) {
+	fields := strings.Fields(normalizeWidth(strings.ToLower(expression)))
+	switch len(fields) {
+	case 1:
+		if fields[0] == "now" || fields[0] == "今" {
+			return now, nil
+		}
+		if strings.HasPrefix(fields[0], "-") || strings.HasPrefix(fields[0], "+") {
+			duration, err := time.ParseDuration(fields[0])
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid relative time '%s'", fields[0])
+			}
+			return now.Add(duration), nil
+		}
+		return parseClock(now, fields[0])
+	case 2:
+		date, err := parseDate(fields[0], now)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return parseClock(date, fields[1])
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s'", expression)
+}
+
+// parseClock returns the time of the clock on the day.
+func parseClock(day time.Time, clock string) (time.Time, error) {
+	hour, minute := -1, 0
+	if m := clockPattern.FindStringSubmatch(clock); m != nil {
+		hour, _ = strconv.Atoi(m[1])
+		minute, _ = strconv.Atoi(m[2])
+	} else if m := compactClockPattern.FindStringSubmatch(clock); m != nil {
+		hour, _ = strconv.Atoi(m[1])
+		minute, _ = strconv.Atoi(m[2])
+	} else if m := japaneseClockPattern.FindStringSubmatch(clock); m != nil {
+		hour, _ = strconv.Atoi(m[1])
+		if m[2] == "半" {
+			minute = 30
+		} else if m[3] != "" {
+			minute, _ = strconv.Atoi(m[3])
+		}
+	} else if m := meridiemClockPattern.FindStringSubmatch(clock); m != nil {
+		hour, _ = strconv.Atoi(m[1])
+		if m[2] != "" {
+			minute, _ = strconv.Atoi(m[2])
+		}
+		if hour < 1 || hour > 12 {
+			return time.Time{}, fmt.Errorf("invalid time '%s'", clock)
+		}
+		hour %= 12
+		if m[3] == "pm" {
+			hour += 12
+		}
+	}
+	if hour < 0 || hour > 23 || minute > 59 {
+		return time.Time{}, fmt.Errorf("invalid time '%s'", clock)
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location()), nil
+}
+
+// parseDate returns the beginning of the day. A date without the year is the latest one not after now.
+func parseDate(date string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch date {
+	case "today", "今日":
+		return today, nil
+	case "yesterday", "昨日":
+		return today.AddDate(0, 0, -1), nil
+	}
+
+	for _, layout := range []string{"2006-01-02", "2006/01/02", "2006/1/2"} {
+		if t, err := time.ParseInLocation(layout, date, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	if m := shortDatePattern.FindStringSubmatch(date); m != nil {
+		month, _ := strconv.Atoi(m[1])
+		day, _ := strconv.Atoi(m[2])
+		if month >= 1 && month <= 12 && day >= 1 && day <= 31 {
+			t := time.Date(now.Year(), time.Month(month), day, 0, 0, 0, 0, now.Location())
+			if t.After(today) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s'", date)
+}
+
+// normalizeWidth converts full-width digits and symbols typed with a Japanese input method.
+func normalizeWidth(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '０' && r <= '９':
+			return r - '０' + '0'
+		case r == '：':
+			return ':'
+		case r == '／':
+			return '/'
+		case r == '－' || r == 'ー':
+			return '-'
+		case r == '＋':
+			return '+'
+		case r == '　':
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// slackTime returns the time of a Slack timestamp like "1534500000.123456", which is when the message was sent
+// or the button was clicked. It returns now if the timestamp is invalid.
+func slackTime(ts string) time.Time {
+	seconds, err := strconv.ParseFloat(ts, 64)
+	if err != nil || seconds <= 0 {
+		return now()
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// unusualPunchTime returns why the time of the in/out command looks like a mistake, or "" if it looks fine.
+// A clock-out at night is usual because it may belong to the previous day.
+func unusualPunchTime(command string, clock, now time.Time) string {
+	switch {
+	case clock.After(now.Add(5 * time.Minute)):
+		return "in the future"
+	case now.Sub(clock) > 7*24*time.Hour:
+		return "more than a week ago"
+	case command == "in" && beforeDayBoundary(clock):
+		return "in the middle of the night"
+	}
+	return ""
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeExpression(t *testing.T) {
+	now := time.Date(2018, 8, 18, 10, 0, 0, 0, JST())
+	tests := []struct {
+		expression string
+		want       time.Time
+	}{
+		{"now", now},
+		{"今", now},
+		{"0930", time.Date(2018, 8, 18, 9, 30, 0, 0, JST())},
+		{"930", time.Date(2018, 8, 18, 9, 30, 0, 0, JST())},
+		{"9:30", time.Date(2018, 8, 18, 9, 30, 0, 0, JST())},
+		{"18時半", time.Date(2018, 8, 18, 18, 30, 0, 0, JST())},
+		{"9時5分", time.Date(2018, 8, 18, 9, 5, 0, 0, JST())},
+		{"18時", time.Date(2018, 8, 18, 18, 0, 0, 0, JST())},
+		{"6pm", time.Date(2018, 8, 18, 18, 0, 0, 0, JST())},
+		{"12am", time.Date(2018, 8, 18, 0, 0, 0, 0, JST())},
+		{"6:15PM", time.Date(2018, 8, 18, 18, 15, 0, 0, JST())},
+		{"-15m", time.Date(2018, 8, 18, 9, 45, 0, 0, JST())},
+		{"+1h30m", time.Date(2018, 8, 18, 11, 30, 0, 0, JST())},
+		{"yesterday 0930", time.Date(2018, 8, 17, 9, 30, 0, 0, JST())},
+		{"昨日 18時半", time.Date(2018, 8, 17, 18, 30, 0, 0, JST())},
+		{"today 9:30", time.Date(2018, 8, 18, 9, 30, 0, 0, JST())},
+		{"2018-08-17 1920", time.Date(2018, 8, 17, 19, 20, 0, 0, JST())},
+		{"2018/8/17 19:20", time.Date(2018, 8, 17, 19, 20, 0, 0, JST())},
+		{"8/17 19:20", time.Date(2018, 8, 17, 19, 20, 0, 0, JST())},
+		{"８/１７　１９：２０", time.Date(2018, 8, 17, 19, 20, 0, 0, JST())},
+		{"０９３０", time.Date(2018, 8, 18, 9, 30, 0, 0, JST())},
+		{"ー15m", time.Date(2018, 8, 18, 9, 45, 0, 0, JST())},
+		// A date without the year is the latest one not after today.
+		{"8/19 0900", time.Date(2017, 8, 19, 9, 0, 0, 0, JST())},
+		{"8/18 0900", time.Date(2018, 8, 18, 9, 0, 0, 0, JST())},
+	}
+	for _, test := range tests {
+		got, err := ParseTimeExpression(test.expression, now)
+		if err != nil {
+			t.Errorf("ParseTimeExpression(%q) returned an error: %s", test.expression, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("ParseTimeExpression(%q) = %s, want %s", test.expression, got, test.want)
+		}
+	}
+}
+
+func TestParseTimeExpressionInvalid(t *testing.T) {
+	now := time.Date(2018, 8, 18, 10, 0, 0, 0, JST())
+	for _, expression := range []string{
+		"",
+		"2400",
+		"1260",
+		"24:00",
+		"9:60",
+		"25時",
+		"9時60分",
+		"13pm",
+		"0am",
+		"-15",
+		"+tomorrow",
+		"tomorrow 0930",
+		"13/1 0930",
+		"2018-02-30 0930",
+		"yesterday",
+		"yesterday 0930 extra",
+		"nine",
+	} {
+		if got, err := ParseTimeExpression(expression, now); err == nil {
+			t.Errorf("ParseTimeExpression(%q) = %s, want an error", expression, got)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	day := time.Date(2018, 8, 17, 0, 0, 0, 0, JST())
+	tests := []struct {
+		clock string
+		hour  int
+		min   int
+		valid bool
+	}{
+		{"0000", 0, 0, true},
+		{"2359", 23, 59, true},
+		{"7:05", 7, 5, true},
+		{"18時半", 18, 30, true},
+		{"11pm", 23, 0, true},
+		{"12pm", 12, 0, true},
+		{"2400", 0, 0, false},
+		{"1260", 0, 0, false},
+		{"12345", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, test := range tests {
+		got, err := parseClock(day, test.clock)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("parseClock(%q) = %s, want an error", test.clock, got)
+			}
+			continue
+		}
+		want := time.Date(2018, 8, 17, test.hour, test.min, 0, 0, JST())
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseClock(%q) = %s, %v, want %s", test.clock, got, err, want)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2018, 1, 2, 10, 0, 0, 0, JST())
+	tests := []struct {
+		date string
+		want time.Time
+	}{
+		{"today", time.Date(2018, 1, 2, 0, 0, 0, 0, JST())},
+		{"今日", time.Date(2018, 1, 2, 0, 0, 0, 0, JST())},
+		{"yesterday", time.Date(2018, 1, 1, 0, 0, 0, 0, JST())},
+		{"昨日", time.Date(2018, 1, 1, 0, 0, 0, 0, JST())},
+		{"2017-12-31", time.Date(2017, 12, 31, 0, 0, 0, 0, JST())},
+		{"2017/12/31", time.Date(2017, 12, 31, 0, 0, 0, 0, JST())},
+		{"2017/1/5", time.Date(2017, 1, 5, 0, 0, 0, 0, JST())},
+		{"1/2", time.Date(2018, 1, 2, 0, 0, 0, 0, JST())},
+		// Across the new year, the date belongs to the previous year.
+		{"12/31", time.Date(2017, 12, 31, 0, 0, 0, 0, JST())},
+		{"1-3", time.Date(2017, 1, 3, 0, 0, 0, 0, JST())},
+	}
+	for _, test := range tests {
+		got, err := parseDate(test.date, now)
+		if err != nil || !got.Equal(test.want) {
+			t.Errorf("parseDate(%q) = %s, %v, want %s", test.date, got, err, test.want)
+		}
+	}
+
+	for _, date := range []string{"tomorrow", "0/1", "13/1", "1/32", "2018-13-01", "someday"} {
+		if got, err := parseDate(date, now); err == nil {
+			t.Errorf("parseDate(%q) = %s, want an error", date, got)
+		}
+	}
+}
+
+func TestUnusualPunchTime(t *testing.T) {
+	now := time.Date(2018, 8, 18, 10, 0, 0, 0, JST())
+	tests := []struct {
+		command string
+		clock   time.Time
+		want    string
+	}{
+		{"in", time.Date(2018, 8, 18, 9, 30, 0, 0, JST()), ""},
+		{"in", now.Add(5 * time.Minute), ""},
+		{"in", now.Add(6 * time.Minute), "in the future"},
+		{"out", time.Date(2018, 8, 18, 19, 0, 0, 0, JST()), "in the future"},
+		{"in", now.AddDate(0, 0, -7), ""},
+		{"out", now.AddDate(0, 0, -8), "more than a week ago"},
+		{"in", time.Date(2018, 8, 18, 3, 0, 0, 0, JST()), "in the middle of the night"},
+		{"in", time.Date(2018, 8, 18, 5, 0, 0, 0, JST()), ""},
+		// A clock-out at night may belong to the previous day.
+		{"out", time.Date(2018, 8, 18, 3, 0, 0, 0, JST()), ""},
+	}
+	for _, test := range tests {
+		if got := unusualPunchTime(test.command, test.clock, now); got != test.want {
+			t.Errorf("unusualPunchTime(%q, %s) = %q, want %q", test.command, test.clock, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// slackTimeZone returns the time zone in the Slack profile of the user, or "" if it is unknown.
+func (s *SlackListener) slackTimeZone(userID string) string {
+	info, err := s.client.GetUserInfo(userID)
+	if err != nil {
+		sugar.Warnf("Failed to get the time zone from Slack [%s]: %s", userID, err)
+		return ""
+	}
+	if info.TZ == "" {
+		return ""
+	}
+	if _, err := time.LoadLocation(info.TZ); err != nil {
+		sugar.Warnf("Unknown time zone '%s' [%s]: %s", info.TZ, userID, err)
+		return ""
+	}
+	return info.TZ
+}
+
+// fillTimeZones sets the time zone in the Slack profile to the users who don't have one yet,
+// e.g. the users registered before the time zones were supported.
+func (s *SlackListener) fillTimeZones(users []*User) {
+	for _, user := range users {
+		if user.TimeZone != "" {
+			continue
+		}
+		timeZone := s.slackTimeZone(user.SlackUserID)
+		if timeZone == "" {
+			continue
+		}
+		_, err := UpdateUser(user.SlackUserID, func(user *User) error {
+			// The user may have set the time zone in the meantime.
+			if user.TimeZone == "" {
+				user.TimeZone = timeZone
+			}
+			return nil
+		})
+		if err != nil {
+			sugar.Warnf("Failed to save the time zone [%s]: %s", user.SlackUserID, err)
+		}
+	}
+}
+
+func (s *SlackListener) handleTimeZoneCommand(userID, channel string, fields []string) error {
+	user, err := FindUser(userID)
+	if err != nil {
+		return s.respond(channel, ":warning: You are not registered yet. Send `add [emp_id]` to me first.")
+	}
+
+	if len(fields) == 1 {
+		now := user.Now()
+		return s.respond(channel, fmt.Sprintf("Your time zone is *%s* (UTC%s). It is %s now.", user.Location(), now.Format("-07:00"), now.Format("15:04")))
+	}
+	if len(fields) != 2 {
+		return s.respond(channel, ":warning: Invalid parameters.")
+	}
+
+	timeZone := fields[1]
+	if timeZone == "auto" {
+		timeZone = s.slackTimeZone(userID)
+		if timeZone == "" {
+			return s.respond(channel, ":warning: Failed to get the time zone from your Slack profile.")
+		}
+	} else if _, err := time.LoadLocation(timeZone); err != nil {
+		return s.respond(channel, fmt.Sprintf(":warning: Unknown time zone '%s'. Use a name like `Asia/Tokyo` or `Europe/Berlin`.", timeZone))
+	}
+	user, err = UpdateUser(userID, func(user *User) error {
+		user.TimeZone = timeZone
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.respond(channel, fmt.Sprintf(":ok: Your time zone was set to *%s*. It is %s now.", user.TimeZone, user.Now().Format("15:04")))
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const undoDir = "undo"
+
+var (
+	// undoWindow is how long a change can be undone. It is set from undo_window in config.toml.
+	undoWindow = 30 * time.Minute
+	undoMutex  sync.Mutex
+)
+
+// Change keeps the work records and the punches before a change made through the bot.
+type Change struct {
+	ID      string                            `json:"id"`
+	Action  string                            `json:"action"`
+	At      time.Time                         `json:"at"`
+	Records map[string]map[string]interface{} `json:"records"`
+	Punches map[string]Punch                  `json:"punches"`
+
+	userID string
+}
+
+type UndoLog struct {
+	SlackUserID string    `json:"slack_user_id"`
+	Changes     []*Change `json:"changes"`
+}
+
+func newChange(userID, action string) *Change {
+	now := time.Now()
+	return &Change{
+		ID:      fmt.Sprint(now.UnixNano()),
+		Action:  action,
+		At:      now,
+		Records: map[string]map[string]interface{}{},
+		Punches: map[string]Punch{},
+		userID:  userID,
+	}
+}
+
+// add keeps the record of the date fetched before the change. It must be called before the punch log is updated.
+// The date can't be undone if the record couldn't be fetched.
+func (c *Change) add(date time.Time, before map[string]interface{}) {
+	if before == nil {
+		return
+	}
+	day := date.Format("2006-01-02")
+	c.Records[day] = before
+	c.Punches[day] = FindPunchLog(c.userID).Get(date)
+}
+
+func (c *Change) save() {
+	if len(c.Records) == 0 {
+		return
+	}
+
+	undoMutex.Lock()
+	defer undoMutex.Unlock()
+
+	err := withFileLock(fmt.Sprintf("%s/%s", undoDir, c.userID), func() error {
+		log := FindUndoLog(c.userID)
+		log.Changes = append(log.Changes, c)
+		return log.Save()
+	})
+	if err != nil {
+		sugar.Warnf("Failed to save undo log [%s]: %s", c.userID, err)
+	}
+}
+
+func FindUndoLog(userID string) *UndoLog {
+	log := UndoLog{
+		SlackUserID: userID,
+		Changes:     []*Change{},
+	}
+
+	data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", undoDir, userID))
+	if err != nil {
+		return &log
+	}
+	if err := json.Unmarshal(data, &log); err != nil {
+		sugar.Warnf("Discard broken undo log [%s]: %s", userID, err)
+		return &UndoLog{SlackUserID: userID, Changes: []*Change{}}
+	}
+
+	changes := []*Change{}
+	for _, change := range log.Changes {
+		if time.Since(change.At) < undoWindow {
+			changes = append(changes, change)
+		}
+	}
+	log.Changes = changes
+
+	return &log
+}
+
+func (l *UndoLog) Save() error {
+	text, err := json.Marshal(*l)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(undoDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(fmt.Sprintf("%s/%s", undoDir, l.SlackUserID), text)
+}
+
+// LastChangeID returns the ID of the latest change that can be undone, or "" if there is none.
+func LastChangeID(userID string) string {
+	undoMutex.Lock()
+	defer undoMutex.Unlock()
+
+	log := FindUndoLog(userID)
+	if len(log.Changes) == 0 {
+		return ""
+	}
+	return log.Changes[len(log.Changes)-1].ID
+}
+
+// Undo restores the records before the latest change. If id is not empty, the latest change must be that one.
+// It returns nil if there is nothing to undo. progress is called after each date is restored unless it is nil.
+func Undo(userID, id, source string, progress func(done, total int)) (*Change, error) {
+	undoMutex.Lock()
+	defer undoMutex.Unlock()
+
+	var change *Change
+	err := withFileLock(fmt.Sprintf("%s/%s", undoDir, userID), func() error {
+		var err error
+		change, err = undoLast(userID, id, source, progress)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+func undoLast(userID, id, source string, progress func(done, total int)) (*Change, error) {
+	log := FindUndoLog(userID)
+	if len(log.Changes) == 0 {
+		return nil, nil
+	}
+	change := log.Changes[len(log.Changes)-1]
+	location := userLocation(userID)
+	if id != "" && change.ID != id {
+		return nil, fmt.Errorf("the change was already undone, or there is a newer change")
+	}
+
+	days := []string{}
+	for day := range change.Records {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	for i, day := range days {
+		date, err := time.ParseInLocation("2006-01-02", day, location)
+		if err != nil {
+			return nil, err
+		}
+		if err := RestoreRecord(userID, date, change.Records[day], source); err != nil {
+			return nil, err
+		}
+		punch := change.Punches[day]
+		RecordPunch(userID, date, func(p *Punch) { *p = punch })
+		if progress != nil {
+			progress(i+1, len(days))
+		}
+	}
+
+	log.Changes = log.Changes[:len(log.Changes)-1]
+	if err := log.Save(); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// Dates returns the dates changed by the change like "2018/08/17, 2018/08/20".
+func (c *Change) Dates() string {
+	days := []string{}
+	for day := range c.Records {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	dates := []string{}
+	for _, day := range days {
+		dates = append(dates, strings.Replace(day, "-", "/", -1))
+	}
+	return strings.Join(dates, ", ")
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"golang.org/x/oauth2"
 	"io/ioutil"
+	"os"
+	"strings"
 	"time"
 )
 
@@ -13,30 +16,102 @@ type User struct {
 	SlackChannelID string       `json:"slack_channel_id"`
 	EmployeeID     string       `json:"emp_id"`
 	Reminder       Reminder     `json:"reminder"`
+	DigestOptOut   bool         `json:"digest_opt_out"`
+	Role           string       `json:"role,omitempty"`
+	TimeZone       string       `json:"time_zone,omitempty"`
 	LastUsed       time.Time    `json:"last_used"`
+	LastError      string       `json:"last_error,omitempty"`
+	LastErrorAt    time.Time    `json:"last_error_at,omitempty"`
 	Token          oauth2.Token `json:"token"`
 }
 
 type Reminder struct {
-	Enabled bool      `json:"enabled"`
-	AM      time.Time `json:"am"`
-	PM      time.Time `json:"pm"`
+	Enabled  bool      `json:"enabled"`
+	AM       time.Time `json:"am"`
+	PM       time.Time `json:"pm"`
+	Snooze   time.Time `json:"snooze"`
+	AlwaysOn bool      `json:"always_on"`
+
+	// AtTime adds a button to the reminders to punch at the scheduled time of the reminder.
+	AtTime bool `json:"at_time"`
+
+	Days map[string]DayReminder `json:"days,omitempty"`
+}
+
+// DayReminder overrides the default reminder times on a specific weekday.
+type DayReminder struct {
+	AM   time.Time `json:"am"`
+	PM   time.Time `json:"pm"`
+	Skip bool      `json:"skip"`
+}
+
+// userChanged is called whenever a user is saved or removed.
+var userChanged = func(userID string) {}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// On returns the reminder times of the weekday. ok is false if the reminder is skipped on that day.
+func (r Reminder) On(weekday time.Weekday) (am, pm time.Time, ok bool) {
+	day, found := r.Days[weekdayNames[weekday]]
+	if !found {
+		return r.AM, r.PM, true
+	}
+	if day.Skip {
+		return time.Time{}, time.Time{}, false
+	}
+	return day.AM, day.PM, true
+}
+
+// ParseWeekdays parses weekday specs like "fri", "mon-thu" or "mon,wed,fri".
+func ParseWeekdays(spec string) ([]time.Weekday, error) {
+	weekdays := []time.Weekday{}
+	for _, part := range strings.Split(strings.ToLower(spec), ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return nil, fmt.Errorf("invalid weekdays '%s'", spec)
+		}
+		first, err := parseWeekday(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = parseWeekday(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			weekdays = append(weekdays, d)
+			if d == last {
+				break
+			}
+		}
+	}
+	return weekdays, nil
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	for i, weekdayName := range weekdayNames {
+		if strings.HasPrefix(name, weekdayName) {
+			return time.Weekday(i), nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("invalid weekday '%s'", name)
+}
+
+func userPath(userID string) string {
+	return fmt.Sprintf("users/%s", userID)
 }
 
 func FindUser(userID string) (*User, error) {
-	data, err := ioutil.ReadFile(fmt.Sprintf("users/%s", userID))
+	data, err := ioutil.ReadFile(userPath(userID))
 	if err != nil {
 		return nil, fmt.Errorf("failed to find user [%s]: %s", userID, err)
 	}
 
-	am, _ := time.Parse("1504", "0900")
-	pm, _ := time.Parse("1504", "1700")
 	user := User{
-		Reminder: Reminder{
-			Enabled: true,
-			AM:      am,
-			PM:      pm,
-		},
+		Reminder: defaultReminder(),
 	}
 	if err := json.Unmarshal(data, &user); err != nil {
 		return nil, err
@@ -45,16 +120,175 @@ func FindUser(userID string) (*User, error) {
 	return &user, nil
 }
 
+// Location returns the time zone of the user. Users without the time zone use JST, the time zone of the company.
+func (u *User) Location() *time.Location {
+	if u.TimeZone != "" {
+		if location, err := time.LoadLocation(u.TimeZone); err == nil {
+			return location
+		}
+	}
+	return JST()
+}
+
+// Now returns the current time in the time zone of the user.
+func (u *User) Now() time.Time {
+	return time.Now().In(u.Location())
+}
+
+// userLocation returns the time zone of the user, or JST if the user is not registered.
+func userLocation(userID string) *time.Location {
+	user, err := FindUser(userID)
+	if err != nil {
+		return JST()
+	}
+	return user.Location()
+}
+
+func defaultReminder() Reminder {
+	am, _ := time.Parse("1504", "0900")
+	pm, _ := time.Parse("1504", "1700")
+	return Reminder{
+		Enabled: true,
+		AM:      am,
+		PM:      pm,
+	}
+}
+
+// Save saves the user as a whole, e.g. when it is registered. Use UpdateUser to change a registered user.
 func (u *User) Save() error {
+	return withFileLock(userPath(u.SlackUserID), u.write)
+}
+
+func (u *User) write() error {
 	text, err := json.Marshal(*u)
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(fmt.Sprintf("users/%s", u.SlackUserID), text, 0644)
+	if err := writeFileAtomic(userPath(u.SlackUserID), text); err != nil {
+		return err
+	}
+	userChanged(u.SlackUserID)
+
+	return nil
+}
+
+// UpdateUser re-reads the user and saves it after the update while holding the lock, so that the changes
+// made by other requests and replicas in the meantime, e.g. a refreshed token, are not overwritten.
+// Nothing is saved if update returns an error.
+func UpdateUser(userID string, update func(user *User) error) (*User, error) {
+	var updated *User
+	err := withFileLock(userPath(userID), func() error {
+		user, err := FindUser(userID)
+		if err != nil {
+			return err
+		}
+		if err := update(user); err != nil {
+			return err
+		}
+		updated = user
+		return user.write()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// TouchUser records that the user used the bot.
+func TouchUser(userID string) {
+	_, err := UpdateUser(userID, func(user *User) error {
+		user.LastUsed = time.Now()
+		return nil
+	})
+	if err != nil {
+		sugar.Warnf("Failed to save the last use [%s]: %s", userID, err)
+	}
+}
+
+// RecordError keeps the last error of the user so that admins can see it in `admin users`.
+func RecordError(userID string, cause error) {
+	_, err := UpdateUser(userID, func(user *User) error {
+		user.LastError = cause.Error()
+		user.LastErrorAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		sugar.Warnf("Failed to save the last error [%s]: %s", userID, err)
+	}
+}
+
+func RemoveUser(userID string) error {
+	err := os.Remove(userPath(userID))
 	if err != nil {
 		return err
 	}
+	userChanged(userID)
 
 	return nil
 }
+
+// AllUsers returns all registered users except the admin.
+func AllUsers() ([]*User, error) {
+	fileInfo, err := ioutil.ReadDir("users")
+	if err != nil {
+		return nil, err
+	}
+
+	users := []*User{}
+	for _, file := range fileInfo {
+		userID := file.Name()
+		if userID == "admin" || strings.HasPrefix(userID, ".") {
+			continue
+		}
+		user, err := FindUser(userID)
+		if err != nil {
+			continue
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// WatchUsers calls changed for each user whose file was added, modified or removed,
+// including the changes made by the other replicas sharing the store.
+func WatchUsers(ctx context.Context, interval time.Duration, changed func(userID string)) error {
+	modTimes := map[string]time.Time{}
+	for {
+		fileInfo, err := ioutil.ReadDir("users")
+		if err != nil {
+			return err
+		}
+
+		found := map[string]time.Time{}
+		for _, file := range fileInfo {
+			userID := file.Name()
+			if userID == "admin" || strings.HasPrefix(userID, ".") {
+				continue
+			}
+			found[userID] = file.ModTime()
+			if modTime, ok := modTimes[userID]; ok && !modTime.Equal(file.ModTime()) {
+				changed(userID)
+			}
+		}
+		for userID := range modTimes {
+			if _, ok := found[userID]; !ok {
+				changed(userID)
+			}
+		}
+		if len(modTimes) != 0 {
+			for userID := range found {
+				if _, ok := modTimes[userID]; !ok {
+					changed(userID)
+				}
+			}
+		}
+		modTimes = found
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// dayBoundary is the time of day when a work day starts. It is set from day_boundary in config.toml.
+// A clock-out before it belongs to the previous day if the previous day is still open, e.g. for night shifts.
+var dayBoundary = 5 * time.Hour
+
+var recordClockPattern = regexp.MustCompile(`^(\d{1,2}):?(\d{2})$`)
+
+func beforeDayBoundary(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return t.Sub(midnight) < dayBoundary
+}
+
+// workDateOfClockOut returns the date of the work record which the clock-out is written to.
+func workDateOfClockOut(client *http.Client, user *User, clockOut time.Time) time.Time {
+	if !beforeDayBoundary(clockOut) {
+		return clockOut
+	}
+
+	previous := clockOut.AddDate(0, 0, -1)
+	endpoint := fmt.Sprintf("%s/api/v1/employees/%s/work_records/%s", apiBase, user.EmployeeID, previous.Format("2006-01-02"))
+	record, err := doGet(client, endpoint)
+	if err != nil {
+		sugar.Warnf("Failed to get the previous day's record [%s]: %s", user.SlackUserID, err)
+		return clockOut
+	}
+	if record["clock_in_at"] == nil || alreadyPunched(user.SlackUserID, record, false) {
+		return clockOut
+	}
+	clockIn, err := time.Parse(time.RFC3339, fmt.Sprint(record["clock_in_at"]))
+	if err != nil || !clockIn.Before(clockOut) || clockOut.Sub(clockIn) > 24*time.Hour {
+		return clockOut
+	}
+	return previous
+}
+
+// parseRecordTime parses the in/out time of a row of the `update` command on the date.
+// Hours past 24 like "2630" are the next day.
+func parseRecordTime(value string, date time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	m := recordClockPattern.FindStringSubmatch(value)
+	if m == nil {
+		return time.Time{}, fmt.Errorf("invalid time '%s'", value)
+	}
+	hour, _ := strconv.Atoi(m[1])
+	minute, _ := strconv.Atoi(m[2])
+	if hour > 47 || minute > 59 {
+		return time.Time{}, fmt.Errorf("invalid time '%s'", value)
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, date.Location()), nil
+}